@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +22,129 @@ import (
 type Cached struct {
 	Tweets       Tweets
 	Lastmodified string
+	Read         ReadMarker
+}
+
+// Marks how far we've read a feed: the first Count tweets, in feed order, of
+// which the last had hash Last. If the feed was rewritten so that doesn't add
+// up anymore, tweets newer than the newest read (Time) are taken as unread.
+// Tweets read out of order, past the first Count, are in Also by hash.
+type ReadMarker struct {
+	Count int
+	Last  string
+	Time  time.Time
+	Also  []string
+}
+
+// Returns the tweets we haven't read.
+func (cached Cached) Unread() Tweets {
+	read := cached.Read
+	also := make(map[string]bool)
+	for _, hash := range read.Also {
+		also[hash] = true
+	}
+	tweets := cached.Tweets
+	if read.Count > 0 && read.Count <= len(tweets) &&
+		tweets[read.Count-1].Hash() == read.Last {
+		tweets = tweets[read.Count:]
+	} else {
+		var newer Tweets
+		for _, tweet := range tweets {
+			if tweet.Created.After(read.Time) {
+				newer = append(newer, tweet)
+			}
+		}
+		tweets = newer
+	}
+	if len(also) == 0 {
+		return tweets
+	}
+	var unread Tweets
+	for _, tweet := range tweets {
+		if !also[tweet.Hash()] {
+			unread = append(unread, tweet)
+		}
+	}
+	return unread
+}
+
+// Gives feeds never marked as read a marker at since, so that only tweets
+// created after it are unread. Nothing is done if since is zero.
+func (cache Cache) SeedRead(since time.Time) {
+	if since.IsZero() {
+		return
+	}
+	for url, cached := range cache {
+		if cached.Read.Count == 0 && cached.Read.Time.IsZero() && len(cached.Read.Also) == 0 {
+			cached.Read.Time = since
+			cache[url] = cached
+		}
+	}
+}
+
+// Marks all cached tweets of the feed at url as read.
+func (cache Cache) MarkRead(url string) {
+	cached, ok := cache[url]
+	if !ok {
+		return
+	}
+	read := ReadMarker{Count: len(cached.Tweets)}
+	for _, tweet := range cached.Tweets {
+		if tweet.Created.After(read.Time) {
+			read.Time = tweet.Created
+		}
+	}
+	if read.Count > 0 {
+		read.Last = cached.Tweets[read.Count-1].Hash()
+	}
+	cached.Read = read
+	cache[url] = cached
+}
+
+// Marks the tweets of the feed at url that were seen (by hash) as read,
+// leaving the other unread ones unread.
+func (cache Cache) MarkSeen(url string, seen map[string]bool) {
+	cached, ok := cache[url]
+	if !ok {
+		return
+	}
+	unread := make(map[string]bool)
+	for _, tweet := range cached.Unread() {
+		if !seen[tweet.Hash()] {
+			unread[tweet.Hash()] = true
+		}
+	}
+	// Moving the marker past all read up to the first unread, the rest read
+	// go in Also
+	read := cached.Read
+	read.Also = nil
+	count := 0
+	for count < len(cached.Tweets) && !unread[cached.Tweets[count].Hash()] {
+		count++
+	}
+	for _, tweet := range cached.Tweets[count:] {
+		if hash := tweet.Hash(); !unread[hash] {
+			read.Also = append(read.Also, hash)
+		}
+	}
+	if count > 0 {
+		read.Count, read.Last = count, cached.Tweets[count-1].Hash()
+		for _, tweet := range cached.Tweets[:count] {
+			if tweet.Created.After(read.Time) {
+				read.Time = tweet.Created
+			}
+		}
+	}
+	cached.Read = read
+	cache[url] = cached
+}
+
+// Replaces the cached tweets of the feed at url, keeping its read marker.
+func (cache Cache) update(url string, tweets Tweets, lastmodified string) {
+	cached := cache[url]
+	cached.Tweets = tweets
+	cached.Lastmodified = lastmodified
+	cache[url] = cached
 }
 
 // key: url
@@ -34,26 +158,22 @@ func (cache Cache) Store(configpath string) {
 		panic(err)
 	}
 
-	f, err := os.OpenFile(fmt.Sprintf("%s/cache", configpath),
-		os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
+	// Not to leave a broken cache behind if interrupted
+	if err := writeFileAtomic(fmt.Sprintf("%s/cache", configpath), b.Bytes(), false); err != nil {
 		panic(err)
 	}
 
-	defer f.Close()
-
-	if _, err = f.Write(b.Bytes()); err != nil {
-		panic(err)
-	}
+	cache.UpdateIndex(configpath)
 }
 
+// Returns when the cache was last stored, or zero if never.
 func CacheLastModified(configpath string) (time.Time, error) {
 	stat, err := os.Stat(fmt.Sprintf("%s/cache", configpath))
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return time.Time{}, err
 		}
-		return time.Unix(0, 0), nil
+		return time.Time{}, nil
 	}
 	return stat.ModTime(), nil
 }
@@ -80,11 +200,46 @@ func LoadCache(configpath string) Cache {
 
 const maxfetchers = 50
 
+// Whether to fetch without showing progress, like when the screen is ours.
+var quiet bool
+
 func (cache Cache) FetchTweets(sources map[string]string) {
+	cache.fetchFeeds(sources).finish(cache)
+}
+
+// What fetchFeeds found, to be finished on the goroutine owning conf: feeds
+// that moved, and what cached feeds had before, for notifying of what arrived.
+type feedsFetch struct {
+	sources map[string]string
+	moved   map[string][2]string // nick: from, to
+	before  map[string]map[string]bool
+}
+
+// Fetches the feeds into cache, leaving conf alone so that it can be run in
+// the background.
+func (cache Cache) fetchFeeds(sources map[string]string) *feedsFetch {
 	var mu sync.RWMutex
 
+	moved := make(map[string][2]string)
+	// What feeds already cached had, for notifying of what arrives
+	before := make(map[string]map[string]bool)
+	if conf.Notify.Command != "" || conf.Hooks.Fetch != "" || conf.Hooks.Mention != "" {
+		for _, url := range sources {
+			if cached, ok := cache[url]; ok {
+				hashes := make(map[string]bool)
+				for _, tweet := range cached.Tweets {
+					hashes[tweet.Hash()] = true
+				}
+				before[url] = hashes
+			}
+		}
+	}
+
 	// progress bar
 	bar := progressbar.Default(int64(len(sources)), "Updating feeds...")
+	if quiet {
+		bar = progressbar.NewOptions64(int64(len(sources)), progressbar.OptionSetWriter(ioutil.Discard))
+	}
 
 	// buffered to let goroutines write without blocking before the main thread
 	// begins reading
@@ -159,15 +314,10 @@ func (cache Cache) FetchTweets(sources map[string]string) {
 				if debug {
 					log.Printf("feed for %s changed from %s to %s", nick, url, actualurl)
 				}
+				mu.Lock()
+				moved[nick] = [2]string{url, actualurl}
+				mu.Unlock()
 				url = actualurl
-				conf.Following[nick] = url
-				if err := conf.Write(); err != nil {
-					if debug {
-						log.Printf("%s: conf.Write fail: %s", url, err)
-					}
-					tweetsch <- nil
-					return
-				}
 			}
 
 			var tweets Tweets
@@ -178,7 +328,7 @@ func (cache Cache) FetchTweets(sources map[string]string) {
 				tweets = ParseFile(scanner, Tweeter{Nick: nick, URL: url})
 				lastmodified := resp.Header.Get("Last-Modified")
 				mu.Lock()
-				cache[url] = Cached{Tweets: tweets, Lastmodified: lastmodified}
+				cache.update(url, tweets, lastmodified)
 				mu.Unlock()
 			case http.StatusNotModified: // 304
 				mu.RLock()
@@ -214,6 +364,51 @@ func (cache Cache) FetchTweets(sources map[string]string) {
 	if debug {
 		log.Print("\n")
 	}
+	return &feedsFetch{sources: sources, moved: moved, before: before}
+}
+
+// Follows the feeds that moved to where they went, and notifies and runs the
+// hooks of what arrived.
+func (fetch *feedsFetch) finish(cache Cache) {
+	// Discovered feeds we don't follow are not in the config
+	write := false
+	for nick, move := range fetch.moved {
+		if conf.Following[nick] == move[0] {
+			conf.Following[nick] = move[1]
+			write = true
+		}
+	}
+	if write {
+		if err := conf.Write(); err != nil {
+			log.Printf("error writing config: %s", err)
+		}
+	}
+
+	var arrived Tweets
+	for url, hashes := range fetch.before {
+		for _, tweet := range cache[url].Tweets {
+			if !hashes[tweet.Hash()] {
+				arrived = append(arrived, tweet)
+			}
+		}
+	}
+	sort.Sort(arrived)
+	NotifyTweets(arrived)
+	for _, tweet := range Mentioning(arrived.Filter(&conf.Filters, time.Now())) {
+		if conf.IsOwnURL(tweet.Tweeter.URL) {
+			continue
+		}
+		if err := runHook("mention", conf.Hooks.Mention, tweetEnv(tweet)); err != nil {
+			log.Print(err)
+		}
+	}
+	env := []string{
+		fmt.Sprintf("TWET_FEEDS=%d", len(fetch.sources)),
+		fmt.Sprintf("TWET_NEW=%d", len(arrived)),
+	}
+	if err := runHook("fetch", conf.Hooks.Fetch, env); err != nil {
+		log.Print(err)
+	}
 }
 
 func ReadLocalFile(url, nick string, tweetsch chan<- Tweets, cache Cache, mu sync.Locker) error {
@@ -244,7 +439,7 @@ func ReadLocalFile(url, nick string, tweetsch chan<- Tweets, cache Cache, mu syn
 	tweets := ParseFile(scanner, Tweeter{Nick: nick, URL: url})
 	lastmodified := file.ModTime().String()
 	mu.Lock()
-	cache[url] = Cached{Tweets: tweets, Lastmodified: lastmodified}
+	cache.update(url, tweets, lastmodified)
 	mu.Unlock()
 	tweetsch <- tweets
 	return nil
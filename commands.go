@@ -3,10 +3,16 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"regexp"
 	"sort"
 	"strings"
@@ -19,6 +25,8 @@ func FollowingCommand(args []string) error {
 	fs := flag.NewFlagSet("following", flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
 	rawFlag := fs.Bool("r", false, "output following users in machine parsable format")
+	listFlag := fs.String("l", "", "only display users in given `list`")
+	jsonFlag := fs.Bool("json", false, "output following users as JSON, one object per line")
 
 	fs.Usage = func() {
 		fmt.Printf("usage: %s following [arguments]\n\nDisplays a list of users being followed.\n\n", progname)
@@ -35,11 +43,30 @@ func FollowingCommand(args []string) error {
 		return fmt.Errorf("too many arguments given")
 	}
 
-	for nick, url := range conf.Following {
+	following := conf.Following
+	if *listFlag != "" {
+		var err error
+		if following, err = conf.ListSources(*listFlag); err != nil {
+			return err
+		}
+	}
+
+	for nick, url := range following {
+		if *jsonFlag {
+			PrintJSON(struct {
+				Nick  string   `json:"nick"`
+				URL   string   `json:"url"`
+				Lists []string `json:"lists,omitempty"`
+			}{nick, url, conf.NickLists(nick)})
+			continue
+		}
 		if *rawFlag {
 			PrintFolloweeRaw(nick, url)
 		} else {
 			PrintFollowee(nick, url)
+			if lists := conf.NickLists(nick); len(lists) > 0 {
+				fmt.Printf(" [%s]", strings.Join(lists, ", "))
+			}
 		}
 		fmt.Println()
 	}
@@ -50,9 +77,16 @@ func FollowingCommand(args []string) error {
 func FollowCommand(args []string) error {
 	fs := flag.NewFlagSet("follow", flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
+	listFlag := fs.String("l", "", "also add nick to `list`, creating it if needed")
 
 	fs.Usage = func() {
-		fmt.Printf("usage: %s follow <nick> <twturl>\n\nStart following @<nick url>.\n\n", progname)
+		fmt.Printf(`usage: %s follow [-l list] <nick> <twturl>
+   or: %s follow -l list <nick>
+
+Start following @<nick url>. With -l, nick is added to the list; the url can
+be left out if nick is already followed.
+
+`, progname, progname)
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
@@ -62,29 +96,52 @@ func FollowCommand(args []string) error {
 		return fmt.Errorf("error parsing arguments")
 	}
 
-	if fs.NArg() < 2 {
+	if fs.NArg() < 1 || (fs.NArg() < 2 && *listFlag == "") {
 		return fmt.Errorf("too few arguments given")
 	}
 
 	nick := fs.Args()[0]
-	url := fs.Args()[1]
+	url := fs.Arg(1)
+	if url == "" {
+		var ok bool
+		if url, ok = conf.Following[nick]; !ok {
+			return fmt.Errorf("not following %q, need a twturl", nick)
+		}
+	}
 
+	if conf.Following == nil {
+		conf.Following = make(map[string]string)
+	}
+	newly := conf.Following[nick] != url
 	conf.Following[nick] = url
+	if *listFlag != "" {
+		if conf.Lists == nil {
+			conf.Lists = make(map[string][]string)
+		}
+		conf.Lists[*listFlag] = toggle(conf.Lists[*listFlag], nick, false)
+	}
 	if err := conf.Write(); err != nil {
 		return fmt.Errorf("error: writing config failed with  %s", err)
 	}
 
 	fmt.Printf("%s successfully started following %s @ %s", yellow("✓"), blue(nick), url)
+	if *listFlag != "" {
+		fmt.Printf(" in list %s", *listFlag)
+	}
 
+	if newly {
+		return runHook("follow", conf.Hooks.Follow, []string{"TWET_NICK=" + nick, "TWET_URL=" + url})
+	}
 	return nil
 }
 
 func UnfollowCommand(args []string) error {
 	fs := flag.NewFlagSet("unfollow", flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
+	listFlag := fs.String("l", "", "only remove nick from `list`, still following")
 
 	fs.Usage = func() {
-		fmt.Printf("usage: %s unfollow <nick>\n\nStop following @nick.\n\n", progname)
+		fmt.Printf("usage: %s unfollow [-l list] <nick>\n\nStop following @nick.\n\n", progname)
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
@@ -98,13 +155,38 @@ func UnfollowCommand(args []string) error {
 	}
 
 	nick := fs.Args()[0]
+	if *listFlag != "" {
+		if _, ok := conf.Lists[*listFlag]; !ok {
+			return fmt.Errorf("no list named %q", *listFlag)
+		}
+		conf.Lists[*listFlag] = toggle(conf.Lists[*listFlag], nick, true)
+		if len(conf.Lists[*listFlag]) == 0 {
+			delete(conf.Lists, *listFlag)
+		}
+		if err := conf.Write(); err != nil {
+			return fmt.Errorf("error: writing config failed with  %s", err)
+		}
+		fmt.Printf("%s successfully removed %s from list %s", yellow("✓"), blue(nick), *listFlag)
+		return nil
+	}
+
+	url, followed := conf.Following[nick]
 	delete(conf.Following, nick)
+	for name := range conf.Lists {
+		conf.Lists[name] = toggle(conf.Lists[name], nick, true)
+		if len(conf.Lists[name]) == 0 {
+			delete(conf.Lists, name)
+		}
+	}
 	if err := conf.Write(); err != nil {
 		return fmt.Errorf("error: writing config failed with  %s", err)
 	}
 
 	fmt.Printf("%s successfully stopped following %s", yellow("✓"), blue(nick))
 
+	if followed {
+		return runHook("unfollow", conf.Hooks.Unfollow, []string{"TWET_NICK=" + nick, "TWET_URL=" + url})
+	}
 	return nil
 }
 
@@ -117,9 +199,32 @@ func TimelineCommand(args []string) error {
 	dryFlag := fs.Bool("n", false, "dry-run, only locally cached tweets")
 	rawFlag := fs.Bool("r", false, "output tweets in URL-prefixed twtxt format")
 	reversedFlag := fs.Bool("desc", false, "tweets shown in descending order (newer tweets at top)")
+	tagFlag := fs.String("t", "", "only show tweets tagged with `tag`")
+	unreadFlag := fs.Bool("unread", false, "only show tweets not yet marked as read (like timeline config new)")
+	markFlag := fs.Bool("m", false, "mark the shown feeds as read afterwards, all of their tweets")
+	keepFlag := fs.Bool("k", false, "keep the tweets shown unread, when only showing unread tweets")
+	listFlag := fs.String("l", "", "only show timeline for nicks in given `list`")
+	jsonFlag := fs.Bool("json", false, "output tweets as JSON, one object per line")
+	formatFlag := fs.String("format", "", "print tweets in `format`, named in config or a template")
+	countFlag := fs.Int("c", 0, "only show the `count` newest tweets (of those otherwise shown)")
+	sinceFlag := fs.String("since", "", "only show tweets created at or after `time` (date, date with time, or duration back)")
+	untilFlag := fs.String("until", "", "only show tweets created before `time`")
+	beforeFlag := fs.String("before", "", "only show tweets older than the one with `hash` (or start of it)")
 
 	fs.Usage = func() {
-		fmt.Printf("usage: %s timeline [arguments]\n\nDisplays the timeline.\n\n", progname)
+		fmt.Printf(`usage: %s timeline [arguments]
+
+Displays the timeline.
+
+When only showing unread tweets (timeline config new, or -unread), the tweets
+shown are marked as read afterwards, unless -k or -n is given. As feeds are
+read in order, a tweet left out (like by -c or -before) keeps the ones after
+it in its feed unread too.
+
+To browse history in chunks, use -c with -before, giving the hash of the
+oldest tweet shown last time.
+
+`, progname)
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
@@ -134,94 +239,263 @@ func TimelineCommand(args []string) error {
 	if *durationFlag < 0 {
 		return fmt.Errorf("negative duration doesn't make sense")
 	}
+	if *formatFlag != "" {
+		if err := SetFormat(*formatFlag); err != nil {
+			return err
+		}
+	}
+	if *countFlag < 0 {
+		return fmt.Errorf("negative count doesn't make sense")
+	}
+	now := time.Now()
+	var since, until time.Time
+	if *sinceFlag != "" {
+		var err error
+		if since, err = ParseUserTime(*sinceFlag, now, true); err != nil {
+			return err
+		}
+	}
+	if *untilFlag != "" {
+		var err error
+		if until, err = ParseUserTime(*untilFlag, now, true); err != nil {
+			return err
+		}
+	}
 	if *fullFlag {
 		if *durationFlag > 0 {
 			return fmt.Errorf("full timeline with duration makes no sense")
 		}
+		if *unreadFlag {
+			return fmt.Errorf("full timeline with only unread makes no sense")
+		}
 		conf.Timeline = "full"
 	}
-
-	cache := LoadCache(configpath)
-	cacheLastModified, err := CacheLastModified(configpath)
-	if err != nil {
-		return fmt.Errorf("error calculating last modified cache time: %s", err)
+	if *unreadFlag {
+		conf.Timeline = "new"
 	}
 
-	var sourceURL string
-
-	if !*dryFlag {
-		var sources = conf.Following
-
-		if conf.IncludeYourself {
-			sources[conf.Nick] = conf.Twturl
-		}
-
-		if *sourceFlag != "" {
-			url, ok := conf.Following[*sourceFlag]
-			if !ok {
+	sources := followedSources()
+	switch {
+	case *sourceFlag != "" && *listFlag != "":
+		return fmt.Errorf("both nick and list makes no sense")
+	case *sourceFlag != "":
+		url, ok := sources[*sourceFlag]
+		if !ok {
+			if !*dryFlag {
 				return fmt.Errorf("no source with nick %q", *sourceFlag)
 			}
-			sources = make(map[string]string)
-			sources[*sourceFlag] = url
-			sourceURL = url
+			url = *sourceFlag
+		}
+		sources = map[string]string{*sourceFlag: url}
+	case *listFlag != "":
+		var err error
+		if sources, err = conf.ListSources(*listFlag); err != nil {
+			return err
 		}
+	}
 
-		cache.FetchTweets(sources)
-		cache.Store(configpath)
+	cache := LoadCache(configpath)
+	// Feeds without read markers (like from before there were any) have
+	// unread what arrived since the cache was last stored, as it used to be
+	stored, err := CacheLastModified(configpath)
+	if err != nil {
+		return fmt.Errorf("error reading cache: %s", err)
+	}
 
-		// Did the url for *sourceFlag change?
-		if sources[*sourceFlag] != conf.Following[*sourceFlag] {
-			sources[*sourceFlag] = conf.Following[*sourceFlag]
-			sourceURL = conf.Following[*sourceFlag]
+	if !*dryFlag {
+		cache.FetchTweets(sources)
+		if conf.Timeline == "new" {
+			cache.SeedRead(stored)
 		}
+		cache.Store(configpath)
+		refreshSources(sources)
+	} else if conf.Timeline == "new" {
+		cache.SeedRead(stored)
 	}
 
 	if debug && *dryFlag {
 		log.Print("dry run\n")
 	}
 
+	var urls []string
+	for _, url := range sources {
+		urls = append(urls, url)
+	}
 	var tweets Tweets
-	if *sourceFlag != "" {
-		tweets = cache.GetByURL(sourceURL)
-	} else {
-		for _, url := range conf.Following {
+	for _, url := range urls {
+		if conf.Timeline == "new" {
+			tweets = append(tweets, cache[url].Unread()...)
+		} else {
 			tweets = append(tweets, cache.GetByURL(url)...)
 		}
 	}
+	sort.Sort(tweets)
+	// Tweets hidden by the filters are as good as seen, not to keep the ones
+	// after them unread
+	seen := make(map[string]bool)
+	for _, tweet := range tweets {
+		seen[tweet.Hash()] = true
+	}
+	for _, tweet := range tweets.Filter(&conf.Filters, now) {
+		delete(seen, tweet.Hash())
+	}
+	if before := NormalizeHash(*beforeFlag); before != "" {
+		found := -1
+		for i, tweet := range tweets {
+			if !strings.HasPrefix(tweet.Hash(), before) {
+				continue
+			}
+			if found != -1 {
+				return fmt.Errorf("hash %q is ambiguous", *beforeFlag)
+			}
+			found = i
+		}
+		if found == -1 {
+			return fmt.Errorf("no tweet with hash %q in the timeline", *beforeFlag)
+		}
+		tweets = tweets[:found]
+	}
+
+	var shown Tweets
+	for _, tweet := range tweets.Filter(&conf.Filters, now) {
+		if *tagFlag != "" && !tweet.HasTag(*tagFlag) {
+			continue
+		}
+		if *durationFlag > 0 && now.Sub(tweet.Created) > *durationFlag {
+			continue
+		}
+		if (!since.IsZero() && tweet.Created.Before(since)) ||
+			(!until.IsZero() && !tweet.Created.Before(until)) {
+			continue
+		}
+		shown = append(shown, tweet)
+	}
+	more := 0
+	if *countFlag > 0 && len(shown) > *countFlag {
+		more = len(shown) - *countFlag
+		shown = shown[more:]
+	}
+	var oldest string
+	if len(shown) > 0 {
+		oldest = shown[0].Hash()
+	}
 	if *reversedFlag {
-		sort.Sort(sort.Reverse(tweets))
-	} else {
-		sort.Sort(tweets)
+		sort.Sort(sort.Reverse(shown))
 	}
 
-	now := time.Now()
-	for _, tweet := range tweets {
-		if (*durationFlag > 0 && now.Sub(tweet.Created) <= *durationFlag) ||
-			(conf.Timeline == "full" && *durationFlag == 0) ||
-			(conf.Timeline == "new" && tweet.Created.Sub(cacheLastModified) >= 0) {
-			if !*rawFlag {
-				PrintTweet(tweet, now)
-			} else {
-				PrintTweetRaw(tweet)
-			}
+	stopPager := StartPager()
+	for _, tweet := range shown {
+		switch {
+		case *jsonFlag:
+			PrintTweetJSON(tweet, PrintOptions{})
+		case *rawFlag:
+			PrintTweetRaw(tweet)
 			fmt.Println()
+		default:
+			PrintTweet(tweet, now)
+		}
+	}
+	stopPager()
+	if more > 0 && !*jsonFlag && !*rawFlag {
+		log.Printf("%d older tweets; continue with -before %s", more, oldest)
+	}
+
+	switch {
+	case *markFlag:
+		for _, url := range urls {
+			cache.MarkRead(url)
+		}
+		cache.Store(configpath)
+	case conf.Timeline == "new" && !*keepFlag && !*dryFlag:
+		for _, tweet := range shown {
+			seen[tweet.Hash()] = true
+		}
+		for _, url := range urls {
+			cache.MarkSeen(url, seen)
 		}
+		cache.Store(configpath)
 	}
 
 	return nil
 }
 
+func MarkReadCommand(args []string) error {
+	fs := flag.NewFlagSet("mark-read", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s mark-read [nick...]
+
+Marks the cached tweets of the given followed nicks (all, if none given) as
+read, so that they no longer show in the timeline with -unread.
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+
+	sources := followedSources()
+	var urls []string
+	for _, nick := range fs.Args() {
+		url, ok := sources[nick]
+		if !ok {
+			return fmt.Errorf("no source with nick %q", nick)
+		}
+		urls = append(urls, url)
+	}
+	if fs.NArg() == 0 {
+		for _, url := range sources {
+			urls = append(urls, url)
+		}
+	}
+
+	cache := LoadCache(configpath)
+	for _, url := range urls {
+		cache.MarkRead(url)
+	}
+	cache.Store(configpath)
+
+	fmt.Printf("%s marked %d feed(s) as read\n", yellow("✓"), len(urls))
+	return nil
+}
+
+// Returned by TweetCommand and EditCommand when the user backed out.
+var errAborted = errors.New("aborting tweet")
+
 func TweetCommand(args []string) error {
 	fs := flag.NewFlagSet("tweet", flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
+	editFlag := fs.Bool("e", false, "compose the tweet in $EDITOR, words given are used as template")
+	linesFlag := fs.Bool("l", false, "when reading stdin, tweet each non-empty line separately")
+	atFlag := fs.String("at", "", "queue the tweet for `time` instead of tweeting now. Example: -at 2h, -at 15:04, -at 2006-01-02T15:04")
 	fs.Usage = func() {
-		fmt.Printf(`usage: %s tweet [words]
-   or: %s twet [words]
+		fmt.Printf(`usage: %s tweet [-e] [-at time] [words]
+   or: %s tweet [-l] [-at time] -
+   or: %s twet [-e] [-at time] [words]
 
 Adds a new tweet to your twtfile. Words are joined together with a single
 space. If no words are given, user will be prompted to input the text
-interactively.
-`, progname, progname)
+interactively. End a line with a backslash to continue the tweet on another
+line. Newlines are stored as U+2028 LINE SEPARATOR in the twtfile.
+
+With -e, $EDITOR is opened on a file pre-filled with the given words. Leaving
+the file empty aborts the tweet.
+
+If the only argument is -, the text is read from stdin. With -l, each
+non-empty line of input becomes a tweet of its own.
+
+With -at, the tweet is put in the queue and gets appended to the twtfile by
+"%s queue flush" once the time has come.
+
+The pre hook of the config is run for each tweet, with its text in
+$TWET_TEXT and hash in $TWET_HASH; failing, it vetoes the tweet. The post
+hook is run once afterwards, with the last tweet in those, $TWET_COUNT
+tweets, and them all as JSON lines on stdin.
+`, progname, progname, progname, progname)
 		fs.PrintDefaults()
 	}
 	if err := fs.Parse(args); err != nil {
@@ -231,40 +505,191 @@ interactively.
 		return fmt.Errorf("error parsing arguments")
 	}
 
-	twtfile := conf.Twtfile
-	if twtfile == "" {
-		return fmt.Errorf("cannot tweet without twtfile set in config")
-	}
-	// We don't support shell style ~user/foo.txt :P
-	if strings.HasPrefix(twtfile, "~/") {
-		twtfile = strings.Replace(twtfile, "~", homedir, 1)
+	twtfile, err := conf.TwtfilePath()
+	if err != nil {
+		return err
 	}
 
-	var text string
-	if fs.NArg() == 0 {
-		var err error
-		if text, err = getLine(); err != nil {
+	var texts []string
+	switch {
+	case fs.NArg() == 1 && fs.Arg(0) == "-":
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading stdin: %s", err)
+		}
+		if *linesFlag {
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					texts = append(texts, line)
+				}
+			}
+		} else {
+			texts = append(texts, string(data))
+		}
+	case *linesFlag:
+		return fmt.Errorf("-l only makes sense when reading from stdin")
+	case *editFlag:
+		text, err := editText(strings.Join(fs.Args(), " "))
+		if err != nil {
+			return fmt.Errorf("editor: %v", err)
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return errAborted
+		}
+		texts = append(texts, text)
+	case fs.NArg() == 0:
+		text, err := getLine()
+		if err != nil {
 			return fmt.Errorf("readline: %v", err)
 		}
-	} else {
-		text = strings.Join(fs.Args(), " ")
+		texts = append(texts, text)
+	default:
+		texts = append(texts, strings.Join(fs.Args(), " "))
+	}
+
+	now := time.Now()
+	if *atFlag != "" {
+		at, err := ParseUserTime(*atFlag, now, false)
+		if err != nil {
+			return err
+		}
+		if at.Before(now) {
+			return fmt.Errorf("refusing to schedule tweet in the past: %s", at.Format(time.RFC3339))
+		}
+		now = at
+	} else if last := lastTweetTime(twtfile); !now.Truncate(time.Second).After(last) {
+		// Not going back before what's in the twtfile already
+		now = last.Add(time.Second)
+	}
+
+	// Spacing the timestamps a second apart (the resolution we write) onwards,
+	// so that multiple tweets keep their order.
+	var tweets Tweets
+	for i, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return fmt.Errorf("cowardly refusing to tweet empty text, or only spaces")
+		}
+		tweets = append(tweets, Tweet{
+			Tweeter: Tweeter{Nick: conf.Nick, URL: conf.Twturl},
+			Created: now.Add(time.Duration(i) * time.Second),
+			Text:    EncodeMultiline(ExpandMentions(text)),
+		})
 	}
-	text = strings.TrimSpace(text)
-	if text == "" {
+	if len(tweets) == 0 {
 		return fmt.Errorf("cowardly refusing to tweet empty text, or only spaces")
 	}
-	text = fmt.Sprintf("%s\t%s\n", time.Now().Format(time.RFC3339), ExpandMentions(text))
-	f, err := os.OpenFile(twtfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+
+	if *atFlag != "" {
+		queue, err := LoadQueue(configpath)
+		if err != nil {
+			return err
+		}
+		if err = StoreQueue(configpath, append(queue, tweets...)); err != nil {
+			return err
+		}
+		for _, tweet := range tweets {
+			fmt.Printf("queued for %s:\n", tweet.Created.Format(time.RFC3339))
+			PrintTweetRaw(tweet)
+			fmt.Println()
+		}
+		return nil
+	}
+
+	return PostTweets(twtfile, tweets)
+}
+
+// Appends tweets to our twtfile, running the pre hook for each, and the post
+// hook once for them all. Tweets the pre hook vetoes are left out.
+func PostTweets(twtfile string, tweets Tweets) error {
+	approved, veto := vetTweets("pre-tweet", tweets)
+	if len(approved) > 0 {
+		if err := AppendTweets(twtfile, approved); err != nil {
+			return err
+		}
+		if err := postHook("post-tweet", approved); err != nil {
+			return err
+		}
+	}
+	return veto
+}
+
+// Runs the pre hook for each of tweets as event, returning those it didn't
+// veto (by failing), and an error telling of those it did.
+func vetTweets(event string, tweets Tweets) (Tweets, error) {
+	var approved Tweets
+	var veto error
+	for _, tweet := range tweets {
+		if err := runHook(event, conf.Hooks.Pre, tweetEnv(tweet)); err != nil {
+			veto = err
+			continue
+		}
+		approved = append(approved, tweet)
+	}
+	switch vetoed := len(tweets) - len(approved); {
+	case vetoed == 1 && len(tweets) == 1:
+		return approved, fmt.Errorf("tweet vetoed: %s", veto)
+	case vetoed > 0:
+		return approved, fmt.Errorf("%d of %d tweets vetoed, the last: %s", vetoed, len(tweets), veto)
+	}
+	return approved, nil
+}
+
+// Runs the post hook once for the tweets just written (or deleted), with
+// tweetEnv of the last of them and their number in TWET_COUNT, and them all as
+// JSON, one per line, on stdin.
+func postHook(event string, tweets Tweets) error {
+	if conf.Hooks.Post == "" || len(tweets) == 0 {
+		return nil
+	}
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	for _, tweet := range tweets {
+		if err := enc.Encode(NewJSONTweet(tweet, PrintOptions{})); err != nil {
+			return fmt.Errorf("error encoding tweets for %s hook: %s", event, err)
+		}
+	}
+	env := append(tweetEnv(tweets[len(tweets)-1]), fmt.Sprintf("TWET_COUNT=%d", len(tweets)))
+	return runHookWith(event, conf.Hooks.Post, env, &data)
+}
+
+// Returns the time of the newest tweet in the twtfile, or zero if there's
+// none (or no twtfile).
+func lastTweetTime(twtfile string) time.Time {
+	var last time.Time
+	f, err := os.Open(twtfile)
 	if err != nil {
-		return err
+		return last
 	}
 	defer f.Close()
+	for _, tweet := range ParseFile(bufio.NewScanner(f), Tweeter{}) {
+		if tweet.Created.After(last) {
+			last = tweet.Created
+		}
+	}
+	return last
+}
+
+// Appends tweets to our twtfile.
+func AppendTweets(twtfile string, tweets Tweets) error {
+	var lines string
+	for _, tweet := range tweets {
+		lines += fmt.Sprintf("%s\t%s\n", tweet.Created.Format(time.RFC3339), tweet.Text)
+	}
 
-	var n int
-	if n, err = f.WriteString(text); err != nil {
+	f, err := os.OpenFile(twtfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	n, err := f.WriteString(lines)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Printf("appended %d bytes to %s:\n%s", n, conf.Twtfile, text)
+	fmt.Printf("appended %d bytes to %s:\n%s", n, conf.Twtfile, lines)
 
 	return nil
 }
@@ -308,7 +733,63 @@ func getLine() (string, error) {
 		return
 	})
 
-	return l.Prompt("> ")
+	// A trailing backslash continues the text on the next line.
+	var lines []string
+	prompt := "> "
+	for {
+		line, err := l.Prompt(prompt)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(line, `\`) {
+			lines = append(lines, line)
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		prompt = ". "
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Lets the user edit template in $EDITOR (falling back to vi), returning the
+// resulting text.
+func editText(template string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := ioutil.TempFile("", progname+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if template != "" {
+		template += "\n"
+	}
+	if _, err = f.WriteString(template); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+
+	// Going through the shell, since $EDITOR may carry arguments
+	cmd := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // Turns "@nick" into "@<nick URL>" if we're following nick.
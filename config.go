@@ -9,27 +9,58 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/go-yaml/yaml"
 )
 
+// Shell commands run on events, see runHook and config.yaml.example.
 type Hooks struct {
-	Pre  string
-	Post string
+	Pre      string // before tweeting, deleting or editing; failing vetoes it
+	Post     string // after tweeting, deleting or editing
+	Fetch    string // after fetching feeds
+	Mention  string // for each arriving tweet mentioning us
+	Follow   string
+	Unfollow string
+}
+
+// An identity of ours, with its own twtfile and hooks.
+type Profile struct {
+	Nick    string
+	Twturl  string
+	Twtfile string
+	Hooks   Hooks
 }
 
 type Config struct {
 	Nick             string
 	Twturl           string
 	Twtfile          string
-	Following        map[string]string // nick -> url
+	Following        map[string]string   // nick -> url
+	Lists            map[string][]string // name -> nicks
 	DiscloseIdentity bool
 	Timeline         string
 	Hooks            Hooks
 	IncludeYourself  bool
+	Filters          Filters
+	Profiles         map[string]Profile
+	Format           string            // name of the format tweets are printed in
+	Formats          map[string]string // name -> text/template
+	Color            string            // auto, always or never
+	Theme            map[string]string // role -> style
+	Width            int               // columns to wrap at; 0 for the terminal's, negative for none
+	Time             string            // relative, absolute or mixed
+	Timezone         string            // of absolute times, like Europe/Stockholm; default local
+	Timeformat       string            // of absolute times, as Go time layout
+	Pager            bool              // page output to a terminal through $PAGER
+	Markdown         bool              // render Markdown in tweets
+	Hyperlinks       bool              // make Markdown links OSC 8 hyperlinks
+	Notify           Notify
 	nicks            map[string]string // normalizeURL(url) -> nick
 	path             string            // location of loaded config
+	base             *Profile          // the identity in the config, when using a profile
+	profile          string            // name of the profile in use, if any
 }
 
 func (conf *Config) Write() error {
@@ -37,7 +68,14 @@ func (conf *Config) Write() error {
 		return errors.New("error: no config file path found")
 	}
 
-	data, err := yaml.Marshal(conf)
+	// Not letting the profile in use leak into the main identity
+	out := *conf
+	if conf.base != nil {
+		out.Nick, out.Twturl, out.Twtfile, out.Hooks =
+			conf.base.Nick, conf.base.Twturl, conf.base.Twtfile, conf.base.Hooks
+	}
+
+	data, err := yaml.Marshal(&out)
 	if err != nil {
 		return fmt.Errorf("error marshalling config: %s", err)
 	}
@@ -88,10 +126,151 @@ func (conf *Config) Read(confdir string) string {
 		log.Fatal(fmt.Sprintf("unexpected config timeline: %s", conf.Timeline))
 	}
 
+	if err := SetColorMode(conf.Color); err != nil {
+		log.Fatal(fmt.Sprintf("unexpected config color: %s", err))
+	}
+	if err := SetTimeMode(conf.Time); err != nil {
+		log.Fatal(fmt.Sprintf("unexpected config time: %s", err))
+	}
+	if err := SetTimezone(conf.Timezone); err != nil {
+		log.Fatal(fmt.Sprintf("unexpected config timezone: %s", err))
+	}
+	for role, style := range conf.Theme {
+		if _, ok := defaultTheme[role]; !ok {
+			log.Fatal(fmt.Sprintf("unexpected config theme role: %s", role))
+		}
+		if _, err := parseStyle(style); err != nil {
+			log.Fatal(fmt.Sprintf("unexpected config theme %s: %s", role, err))
+		}
+	}
+
 	conf.path = filepath.Join(foundpath, filename)
 	return foundpath
 }
 
+// Switches to the identity of the named profile, or back to the main one for
+// "". Fields left empty in the profile are kept from the main identity,
+// except hooks, which are the profile's own.
+func (conf *Config) UseProfile(name string) error {
+	profile, ok := conf.Profiles[name]
+	if !ok && name != "" {
+		return fmt.Errorf("no profile named %q", name)
+	}
+	if conf.base == nil {
+		conf.base = &Profile{Nick: conf.Nick, Twturl: conf.Twturl,
+			Twtfile: conf.Twtfile, Hooks: conf.Hooks}
+	}
+	conf.Nick, conf.Twturl, conf.Twtfile, conf.Hooks =
+		conf.base.Nick, conf.base.Twturl, conf.base.Twtfile, conf.base.Hooks
+	conf.profile = name
+	conf.nicks = nil
+	if name == "" {
+		return nil
+	}
+	if profile.Nick != "" {
+		conf.Nick = profile.Nick
+	}
+	if profile.Twturl != "" {
+		conf.Twturl = profile.Twturl
+	}
+	if profile.Twtfile != "" {
+		conf.Twtfile = profile.Twtfile
+	}
+	conf.Hooks = profile.Hooks
+	return nil
+}
+
+// Tells whether url is the feed of any of our identities.
+func (conf *Config) IsOwnURL(url string) bool {
+	url = NormalizeURL(url)
+	if url == "" {
+		return false
+	}
+	own := []string{conf.Twturl}
+	if conf.base != nil {
+		own = append(own, conf.base.Twturl)
+	}
+	for _, profile := range conf.Profiles {
+		own = append(own, profile.Twturl)
+	}
+	for _, u := range own {
+		if NormalizeURL(u) == url {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the path of our twtfile, with any leading ~/ expanded.
+func (conf *Config) TwtfilePath() (string, error) {
+	twtfile := conf.Twtfile
+	if twtfile == "" {
+		return "", errors.New("cannot tweet without twtfile set in config")
+	}
+	// We don't support shell style ~user/foo.txt :P
+	if strings.HasPrefix(twtfile, "~/") {
+		twtfile = strings.Replace(twtfile, "~", homedir, 1)
+	}
+	return twtfile, nil
+}
+
+// Returns the feeds we follow, and our own if conf.IncludeYourself.
+func followedSources() map[string]string {
+	sources := make(map[string]string)
+	for nick, url := range conf.Following {
+		sources[nick] = url
+	}
+	if conf.IncludeYourself && conf.Nick != "" && conf.Twturl != "" {
+		sources[conf.Nick] = conf.Twturl
+	}
+	return sources
+}
+
+// Picks up the new URLs of followed feeds that FetchTweets found had moved.
+func refreshSources(sources map[string]string) {
+	for nick := range sources {
+		if url, ok := conf.Following[nick]; ok {
+			sources[nick] = url
+		}
+	}
+}
+
+// Returns the followed feeds in the named list.
+func (conf *Config) ListSources(name string) (map[string]string, error) {
+	nicks, ok := conf.Lists[name]
+	if !ok {
+		return nil, fmt.Errorf("no list named %q", name)
+	}
+	sources := make(map[string]string)
+	for _, nick := range nicks {
+		url, ok := conf.Following[nick]
+		if !ok {
+			if nick == conf.Nick && conf.Twturl != "" {
+				url = conf.Twturl
+			} else {
+				return nil, fmt.Errorf("%q in list %q is not followed", nick, name)
+			}
+		}
+		sources[nick] = url
+	}
+	return sources, nil
+}
+
+// Returns the names of the lists nick is in.
+func (conf *Config) NickLists(nick string) []string {
+	var names []string
+	for name, nicks := range conf.Lists {
+		for _, n := range nicks {
+			if n == nick {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (conf *Config) urlToNick(url string) string {
 	if conf.nicks == nil {
 		conf.nicks = make(map[string]string)
@@ -101,8 +280,18 @@ func (conf *Config) urlToNick(url string) string {
 			}
 			conf.nicks[u] = n
 		}
-		if conf.Nick != "" && conf.Twturl != "" {
-			conf.nicks[NormalizeURL(conf.Twturl)] = conf.Nick
+		identities := []Profile{{Nick: conf.Nick, Twturl: conf.Twturl}}
+		if conf.base != nil {
+			identities = append(identities, *conf.base)
+		}
+		for _, profile := range conf.Profiles {
+			identities = append(identities, profile)
+		}
+		// The identity in use is set last, to win over others with the same url
+		for i := len(identities) - 1; i >= 0; i-- {
+			if identities[i].Nick != "" && identities[i].Twturl != "" {
+				conf.nicks[NormalizeURL(identities[i].Twturl)] = identities[i].Nick
+			}
 		}
 	}
 	return conf.nicks[NormalizeURL(url)]
@@ -0,0 +1,221 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rules for hiding tweets from the timeline and other displays.
+type Filters struct {
+	Mute                  map[string]string // nick -> until (RFC3339), empty for good
+	Hide                  []string          // regexps matched against the text
+	HideTags              []string
+	HideUnfollowedReplies bool // tweets starting with mentions of only feeds we don't follow
+	hide                  []*regexp.Regexp
+}
+
+// Tells whether nick is muted at now.
+func (filters *Filters) Muted(nick string, now time.Time) bool {
+	until, ok := filters.Mute[nick]
+	if !ok {
+		return false
+	}
+	if until == "" {
+		return true
+	}
+	tm, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		log.Printf("ignoring mute of %s with bad time: %q", nick, until)
+		return false
+	}
+	return now.Before(tm)
+}
+
+var leadingMentionsRE = regexp.MustCompile(`^(\s*@<[^>]+>)+`)
+
+func (filters *Filters) Hidden(tweet Tweet, now time.Time) bool {
+	if filters.Muted(tweet.Tweeter.Nick, now) {
+		return true
+	}
+	for _, tag := range filters.HideTags {
+		if tweet.HasTag(tag) {
+			return true
+		}
+	}
+
+	if filters.hide == nil {
+		filters.hide = []*regexp.Regexp{}
+		for _, expr := range filters.Hide {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				log.Printf("ignoring bad hide regexp %q: %s", expr, err)
+				continue
+			}
+			filters.hide = append(filters.hide, re)
+		}
+	}
+	text := DecodeMultiline(tweet.Text)
+	for _, re := range filters.hide {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+
+	if filters.HideUnfollowedReplies {
+		if leading := leadingMentionsRE.FindString(tweet.Text); leading != "" {
+			followed := false
+			for _, m := range (Tweet{Text: leading}).Mentions() {
+				if conf.urlToNick(m.URL) != "" {
+					followed = true
+					break
+				}
+			}
+			if !followed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the tweets not hidden by the filters.
+func (tweets Tweets) Filter(filters *Filters, now time.Time) Tweets {
+	var shown Tweets
+	for _, tweet := range tweets {
+		if !filters.Hidden(tweet, now) {
+			shown = append(shown, tweet)
+		}
+	}
+	return shown
+}
+
+func MuteCommand(args []string) error {
+	fs := flag.NewFlagSet("mute", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	undoFlag := fs.Bool("undo", false, "remove the given rule instead")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s mute [-undo] [<nick> [until] | #tag | /regexp/]
+
+Manages the filters hiding tweets from timeline, search, mentions and tags.
+Without arguments, the current filters are listed.
+
+  nick [until]  hide tweets by nick, for good or until time (like 2w, 3d,
+                2006-01-02)
+  #tag          hide tweets tagged with tag
+  /regexp/      hide tweets with text matching regexp
+
+Replies to people you don't follow are hidden by setting
+hideunfollowedreplies under filters in the config.
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+
+	filters := &conf.Filters
+	if fs.NArg() == 0 {
+		var nicks []string
+		for nick := range filters.Mute {
+			nicks = append(nicks, nick)
+		}
+		sort.Strings(nicks)
+		now := time.Now()
+		for _, nick := range nicks {
+			until := filters.Mute[nick]
+			switch {
+			case until == "":
+				until = "for good"
+			case !filters.Muted(nick, now):
+				until = "expired " + until
+			default:
+				until = "until " + until
+			}
+			fmt.Printf("> %s muted %s\n", yellow(nick), until)
+		}
+		for _, tag := range filters.HideTags {
+			fmt.Printf("> #%s hidden\n", blue(tag))
+		}
+		for _, expr := range filters.Hide {
+			fmt.Printf("> /%s/ hidden\n", expr)
+		}
+		if filters.HideUnfollowedReplies {
+			fmt.Println("> replies to people not followed hidden")
+		}
+		return nil
+	}
+
+	rule := fs.Arg(0)
+	switch {
+	case strings.HasPrefix(rule, "#") && len(rule) > 1:
+		if fs.NArg() > 1 {
+			return fmt.Errorf("too many arguments given")
+		}
+		filters.HideTags = toggle(filters.HideTags, rule[1:], *undoFlag)
+	case strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") && len(rule) > 2:
+		if fs.NArg() > 1 {
+			return fmt.Errorf("too many arguments given")
+		}
+		expr := rule[1 : len(rule)-1]
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("bad regexp: %s", err)
+		}
+		filters.Hide = toggle(filters.Hide, expr, *undoFlag)
+	default:
+		if fs.NArg() > 2 || (*undoFlag && fs.NArg() > 1) {
+			return fmt.Errorf("too many arguments given")
+		}
+		if *undoFlag {
+			if _, ok := filters.Mute[rule]; !ok {
+				return fmt.Errorf("%s is not muted", rule)
+			}
+			delete(filters.Mute, rule)
+			break
+		}
+		until := ""
+		if fs.NArg() == 2 {
+			tm, err := ParseUserTime(fs.Arg(1), time.Now(), false)
+			if err != nil {
+				return err
+			}
+			until = tm.Format(time.RFC3339)
+		}
+		if filters.Mute == nil {
+			filters.Mute = make(map[string]string)
+		}
+		filters.Mute[rule] = until
+	}
+
+	if err := conf.Write(); err != nil {
+		return fmt.Errorf("error: writing config failed with  %s", err)
+	}
+	fmt.Printf("%s filters updated\n", yellow("✓"))
+	return nil
+}
+
+// Adds s to list, or removes it if remove is set.
+func toggle(list []string, s string, remove bool) []string {
+	var out []string
+	for _, item := range list {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	if !remove {
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The built-in tweet format, used unless another is configured or given.
+const defaultFormat = `> {{.ColoredNick}} ({{style "timestamp" .Timestamp}}){{if .New}} {{style "new" "new"}}{{end}}
+{{wrap "" .Body}}
+`
+
+// What a tweet format template is executed on.
+type TweetView struct {
+	Nick    string
+	URL     string
+	Created time.Time
+	Hash    string
+	Text    string // as written, except newlines being real
+	Own     bool   // tweeted by one of our identities
+	New     bool
+	now     time.Time
+	opts    PrintOptions
+	tweet   Tweet
+}
+
+func NewTweetView(tweet Tweet, now time.Time, opts PrintOptions) TweetView {
+	return TweetView{
+		Nick:    tweet.Tweeter.Nick,
+		URL:     tweet.Tweeter.URL,
+		Created: tweet.Created,
+		Hash:    tweet.Hash(),
+		Text:    DecodeMultiline(tweet.Text),
+		Own:     conf.IsOwnURL(tweet.Tweeter.URL),
+		New:     opts.New,
+		now:     now,
+		opts:    opts,
+		tweet:   tweet,
+	}
+}
+
+// The nick, coloured.
+func (v TweetView) ColoredNick() string {
+	if v.Own {
+		return themed("ownnick", v.Nick)
+	}
+	return themed("nick", v.Nick)
+}
+
+// How long ago the tweet was created.
+func (v TweetView) Ago() string {
+	return PrettyDuration(v.now.Sub(v.Created))
+}
+
+// The time the tweet was created, in the configured timezone and format.
+func (v TweetView) Date() string {
+	return v.Created.In(timeLocation).Format(timeFormat())
+}
+
+// The time the tweet was created, relative or absolute by the time mode.
+func (v TweetView) Timestamp() string {
+	switch timeMode {
+	case "absolute":
+		return v.Date()
+	case "mixed":
+		if v.now.Sub(v.Created) >= oldAge {
+			return v.Ago() + ", " + v.Date()
+		}
+	}
+	return v.Ago()
+}
+
+// The text with mentions shortened and coloured, Markdown rendered if
+// configured, and search matches highlighted.
+func (v TweetView) Body() string {
+	text := v.tweet.Text
+	if markdownEnabled() {
+		text = RenderMarkdown(text)
+	}
+	text = DecodeMultiline(ShortenMentions(text))
+	if v.opts.Highlight != nil {
+		text = Highlight(text, v.opts.Highlight)
+	}
+	return text
+}
+
+var formatFuncs = template.FuncMap{
+	// {{color "bold red" .Nick}}, or by theme role {{color "ownnick" .Nick}}
+	"color": styled,
+	// same as color
+	"style": styled,
+	// {{ago .Created}}
+	"ago": func(t time.Time) string {
+		return PrettyDuration(time.Since(t))
+	},
+	// {{date "2006-01-02 15:04" .Created}}, in the configured timezone
+	"date": func(layout string, t time.Time) string {
+		return t.In(timeLocation).Format(layout)
+	},
+	// {{shorten .Text}}
+	"shorten": ShortenMentions,
+	// {{indent "  " .Body}}
+	"indent": func(prefix, s string) string {
+		return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+	},
+	// {{wrap "  " .Body}}, to the width configured or of the terminal, with
+	// lines continuing a wrapped one starting with the given indentation
+	"wrap": func(hang, s string) string {
+		return Wrap(s, outputWidth(), hang)
+	},
+}
+
+// How timestamps are shown: relative (like "2w ago"), absolute (like
+// "2020-01-02 15:04"), or mixed: relative, adding the absolute time for
+// tweets older than oldAge.
+var timeMode = "relative"
+
+const oldAge = 24 * time.Hour
+
+// Where absolute times are shown in.
+var timeLocation = time.Local
+
+const defaultTimeFormat = "2006-01-02 15:04"
+
+func timeFormat() string {
+	if conf.Timeformat != "" {
+		return conf.Timeformat
+	}
+	return defaultTimeFormat
+}
+
+func SetTimeMode(mode string) error {
+	switch mode = strings.ToLower(mode); mode {
+	case "":
+		timeMode = "relative"
+	case "relative", "absolute", "mixed":
+		timeMode = mode
+	default:
+		return fmt.Errorf("unexpected time mode %q, want relative, absolute or mixed", mode)
+	}
+	return nil
+}
+
+// Sets the timezone absolute times are shown in, by name like
+// "Europe/Stockholm", "UTC", or "Local" (also if empty).
+func SetTimezone(name string) error {
+	if name == "" {
+		name = "Local"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", name)
+	}
+	timeLocation = loc
+	return nil
+}
+
+var tweetTemplate *template.Template
+
+// Sets the format tweets are printed in: the name of one in the config (or
+// "default"), or else a template of its own.
+func SetFormat(format string) error {
+	tmpl := defaultFormat
+	switch {
+	case format == "" || format == "default":
+	case conf.Formats[format] != "":
+		tmpl = conf.Formats[format]
+	case strings.Contains(format, "{{"):
+		tmpl = format
+	default:
+		var names []string
+		for name := range conf.Formats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("no format named %q; configured: %q", format, names)
+	}
+	// Allowing \n and \t when given on the command line
+	tmpl = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(tmpl)
+
+	t, err := template.New("tweet").Funcs(formatFuncs).Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("error parsing format: %s", err)
+	}
+	tweetTemplate = t
+	return nil
+}
+
+// Returns the tweet in the format set, or configured.
+func FormatTweet(tweet Tweet, now time.Time, opts PrintOptions) (string, error) {
+	if tweetTemplate == nil {
+		if err := SetFormat(conf.Format); err != nil {
+			log.Print(err)
+			_ = SetFormat("default")
+		}
+	}
+	var b strings.Builder
+	if err := tweetTemplate.Execute(&b, NewTweetView(tweet, now, opts)); err != nil {
+		return "", fmt.Errorf("error formatting tweet: %s", err)
+	}
+	return b.String(), nil
+}
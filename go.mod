@@ -6,8 +6,10 @@ require (
 	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/goware/urlx v0.3.1
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/mattn/go-runewidth v0.0.9
 	github.com/peterh/liner v1.2.0
 	github.com/schollz/progressbar/v3 v3.3.4
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
 	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
 	golang.org/x/text v0.3.2 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
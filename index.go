@@ -0,0 +1,214 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The full-text index of a cached feed. Postings refer to positions in the
+// feed's cached Tweets. Digest is of the tweets indexed, used for telling
+// whether the cached feed has changed, or only had tweets appended.
+type IndexedFeed struct {
+	Count    int
+	Digest   []byte
+	Terms    []string // sorted
+	Postings [][]int  // by Terms
+}
+
+// key: url
+type Index map[string]*IndexedFeed
+
+func indexFile(configpath string) string {
+	return fmt.Sprintf("%s/index", configpath)
+}
+
+// Loads the index stored next to the cache. An index that can't be read is
+// simply rebuilt, so we start over with an empty one.
+func LoadIndex(configpath string) Index {
+	index := make(Index)
+	data, err := ioutil.ReadFile(indexFile(configpath))
+	if err != nil {
+		if !os.IsNotExist(err) && debug {
+			log.Printf("error reading index: %s", err)
+		}
+		return index
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&index); err != nil {
+		if debug {
+			log.Printf("error decoding index, rebuilding: %s", err)
+		}
+		return make(Index)
+	}
+	return index
+}
+
+func (index Index) Store(configpath string) error {
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(index); err != nil {
+		return err
+	}
+	return writeFileAtomic(indexFile(configpath), b.Bytes(), false)
+}
+
+var wordRE = regexp.MustCompile(`[\pL\pN_]+`)
+
+// Returns the lowercased words, and tags prefixed with #, in text.
+func indexTerms(text string) []string {
+	text = strings.ToLower(DecodeMultiline(text))
+	terms := wordRE.FindAllString(text, -1)
+	return append(terms, tagRE.FindAllString(text, -1)...)
+}
+
+// Returns a digest of the tweets, by their times and texts.
+func digestTweets(tweets Tweets) []byte {
+	h := sha256.New()
+	for _, tweet := range tweets {
+		fmt.Fprintf(h, "%d\t%s\n", tweet.Created.UnixNano(), tweet.Text)
+	}
+	return h.Sum(nil)
+}
+
+// Brings the index up to date with the cache. Feeds that only had tweets
+// appended since last time get just those indexed. Returns whether anything
+// changed.
+func (index Index) Update(cache Cache) bool {
+	changed := false
+	for url := range index {
+		if _, ok := cache[url]; !ok {
+			delete(index, url)
+			changed = true
+		}
+	}
+	for url, cached := range cache {
+		tweets := cached.Tweets
+		feed := index[url]
+		// Whether the tweets indexed are still there, as they were
+		kept := feed != nil && feed.Count <= len(tweets) &&
+			bytes.Equal(feed.Digest, digestTweets(tweets[:feed.Count]))
+		if kept && feed.Count == len(tweets) {
+			continue
+		}
+		start := 0
+		postings := make(map[string][]int)
+		if kept {
+			start = feed.Count
+			for i, term := range feed.Terms {
+				postings[term] = feed.Postings[i]
+			}
+		}
+		for i := start; i < len(tweets); i++ {
+			seen := make(map[string]bool)
+			for _, term := range indexTerms(tweets[i].Text) {
+				if !seen[term] {
+					seen[term] = true
+					postings[term] = append(postings[term], i)
+				}
+			}
+		}
+		feed = &IndexedFeed{Count: len(tweets), Digest: digestTweets(tweets)}
+		for term := range postings {
+			feed.Terms = append(feed.Terms, term)
+		}
+		sort.Strings(feed.Terms)
+		for _, term := range feed.Terms {
+			feed.Postings = append(feed.Postings, postings[term])
+		}
+		index[url] = feed
+		changed = true
+	}
+	return changed
+}
+
+// Returns the positions of tweets having a term starting with term, or being
+// exactly term if exact is set.
+func (feed *IndexedFeed) lookup(term string, exact bool) map[int]bool {
+	found := make(map[int]bool)
+	for i := sort.SearchStrings(feed.Terms, term); i < len(feed.Terms); i++ {
+		if feed.Terms[i] != term && (exact || !strings.HasPrefix(feed.Terms[i], term)) {
+			break
+		}
+		for _, n := range feed.Postings[i] {
+			found[n] = true
+		}
+	}
+	return found
+}
+
+// Returns the positions of the feed's tweets that may match the query, or
+// nil if the query has nothing the index can help with. The candidates still
+// have to be checked with Query.Match.
+func (feed *IndexedFeed) Candidates(q Query) []int {
+	var sets []map[int]bool
+	for _, word := range q.Words {
+		for _, term := range wordRE.FindAllString(word, -1) {
+			sets = append(sets, feed.lookup(term, false))
+		}
+	}
+	for _, tag := range q.Tags {
+		sets = append(sets, feed.lookup("#"+tag, true))
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	candidates := []int{}
+	for n := range sets[0] {
+		all := true
+		for _, set := range sets[1:] {
+			if !set[n] {
+				all = false
+				break
+			}
+		}
+		if all {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+// Loads the index, bringing it up to date with the cache (and storing it) if
+// needed.
+func (cache Cache) UpdateIndex(configpath string) Index {
+	index := LoadIndex(configpath)
+	if index.Update(cache) {
+		if err := index.Store(configpath); err != nil && debug {
+			log.Printf("error storing index: %s", err)
+		}
+	}
+	return index
+}
+
+// Returns the cached tweets matching the query, using the index.
+func (cache Cache) Search(configpath string, q Query) Tweets {
+	index := cache.UpdateIndex(configpath)
+
+	var tweets Tweets
+	for url, cached := range cache {
+		candidates := index[url].Candidates(q)
+		if candidates == nil {
+			for _, tweet := range cached.Tweets {
+				if q.Match(tweet) {
+					tweets = append(tweets, tweet)
+				}
+			}
+			continue
+		}
+		for _, n := range candidates {
+			if q.Match(cached.Tweets[n]) {
+				tweets = append(tweets, cached.Tweets[n])
+			}
+		}
+	}
+	return tweets
+}
@@ -5,8 +5,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 const progname = "twet"
@@ -15,11 +17,16 @@ var homedir string
 var conf Config = Config{
 	DiscloseIdentity: true,
 	Timeline:         "full",
+	Pager:            true,
 }
 var configpath string
 
 var debug bool
 var dir string
+var profile string
+var color string
+var timeFlag string
+var timezone string
 var usage = fmt.Sprintf(`%s is a client for twtxt -- https://twtxt.readthedocs.org/en/stable/
 
 Usage:
@@ -30,7 +37,18 @@ Commands:
 	follow
 	unfollow
 	timeline
+	mark-read
+	mute
 	tweet or twet
+	status
+	queue
+	mentions
+	tags
+	search
+	delete
+	edit
+	tui
+	watch
 
 Use "%s help [command]" for more information about a command.
 
@@ -48,12 +66,48 @@ func main() {
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.BoolVar(&debug, "debug", false, "output debug info")
 	flag.StringVar(&dir, "dir", "", "set config directory")
+	flag.StringVar(&profile, "p", "", "use the identity of `profile` from config")
+	flag.StringVar(&color, "color", "", "colorize output: auto (if terminal and no NO_COLOR), always or never (overrides config)")
+	flag.IntVar(&width, "width", 0, "wrap tweets at `columns`, or -1 to not wrap (overrides config)")
+	flag.StringVar(&timeFlag, "time", "", "show times as `mode`: relative, absolute or mixed (relative, adding the date for old tweets; overrides config)")
+	flag.StringVar(&timezone, "tz", "", "show absolute times in `timezone`, like UTC or Europe/Stockholm (overrides config)")
+	flag.BoolVar(&pagerFlag, "pager", true, "page long output of timeline, search and mentions to a terminal through $PAGER; -pager=false to not (overrides config)")
+	flag.BoolVar(&markdownFlag, "markdown", false, "render Markdown in tweets (overrides config)")
 	flag.Usage = func() {
 		fmt.Print(usage)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "pager":
+			pagerFlagSet = true
+		case "markdown":
+			markdownFlagSet = true
+		}
+	})
 	configpath = conf.Read(dir)
+	if profile != "" {
+		if err := conf.UseProfile(profile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if color != "" {
+		if err := SetColorMode(color); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if timeFlag != "" {
+		if err := SetTimeMode(timeFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if timezone != "" {
+		if err := SetTimezone(timezone); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	switch flag.Arg(0) {
 	case "following":
@@ -73,20 +127,60 @@ func main() {
 			log.Fatal(err)
 		}
 	case "tweet", "twet":
-		if conf.Hooks.Pre != "" {
-			if _, err := execShell(homedir, conf.Hooks.Pre); err != nil {
-				log.Fatalf("error executing pre tweet hook: %s", err)
+		if err := TweetCommand(flag.Args()[1:]); err != nil {
+			if err == errAborted {
+				log.Print(err)
+				return
 			}
+			log.Fatal(err)
 		}
-
-		if err := TweetCommand(flag.Args()[1:]); err != nil {
+	case "queue":
+		if err := QueueCommand(flag.Args()[1:]); err != nil {
 			log.Fatal(err)
 		}
-
-		if conf.Hooks.Post != "" {
-			if _, err := execShell(homedir, conf.Hooks.Post); err != nil {
-				log.Fatalf("error executing post tweet hook: %s", err)
+	case "status":
+		if err := StatusCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "mute":
+		if err := MuteCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "mark-read":
+		if err := MarkReadCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "tags":
+		if err := TagsCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "mentions":
+		if err := MentionsCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "search":
+		if err := SearchCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "delete":
+		if err := DeleteCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "tui":
+		if err := TUICommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "watch":
+		if err := WatchCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "edit":
+		if err := EditCommand(flag.Args()[1:]); err != nil {
+			if err == errAborted {
+				log.Print(err)
+				return
 			}
+			log.Fatal(err)
 		}
 	case "help":
 		switch flag.Arg(1) {
@@ -100,6 +194,28 @@ func main() {
 			_ = TimelineCommand([]string{"-h"})
 		case "tweet", "twet":
 			_ = TweetCommand([]string{"-h"})
+		case "queue":
+			_ = QueueCommand([]string{"-h"})
+		case "status":
+			_ = StatusCommand([]string{"-h"})
+		case "mute":
+			_ = MuteCommand([]string{"-h"})
+		case "mark-read":
+			_ = MarkReadCommand([]string{"-h"})
+		case "tags":
+			_ = TagsCommand([]string{"-h"})
+		case "mentions":
+			_ = MentionsCommand([]string{"-h"})
+		case "search":
+			_ = SearchCommand([]string{"-h"})
+		case "delete":
+			_ = DeleteCommand([]string{"-h"})
+		case "edit":
+			_ = EditCommand([]string{"-h"})
+		case "tui":
+			_ = TUICommand([]string{"-h"})
+		case "watch":
+			_ = WatchCommand([]string{"-h"})
 		case "":
 			flag.Usage()
 			os.Exit(2)
@@ -116,3 +232,31 @@ func main() {
 		log.Fatal(fmt.Sprintf("%q is not a valid command.\n", flag.Arg(0)))
 	}
 }
+
+// Executes a hook command (if any) in the home directory. It gets the event
+// in TWET_EVENT, our twtfile in TWET_FILE, our nick in TWET_NICK (unless env
+// has another), and env, in its environment.
+func runHook(event, cmd string, env []string) error {
+	return runHookWith(event, cmd, env, nil)
+}
+
+// Like runHook, giving the command stdin.
+func runHookWith(event, cmd string, env []string, stdin io.Reader) error {
+	if cmd == "" {
+		return nil
+	}
+	twtfile, _ := conf.TwtfilePath()
+	env = append([]string{
+		"TWET_EVENT=" + event,
+		"TWET_FILE=" + twtfile,
+		"TWET_NICK=" + conf.Nick,
+	}, env...)
+	res, err := execShellWith(homedir, cmd, env, stdin)
+	if err != nil {
+		if out := strings.TrimSpace(string(res.Output)); out != "" {
+			return fmt.Errorf("error executing %s hook: %s: %s", event, err, out)
+		}
+		return fmt.Errorf("error executing %s hook: %s", event, err)
+	}
+	return nil
+}
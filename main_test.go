@@ -1,6 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -84,3 +90,717 @@ func TestNormalizeURL(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalizeHash(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out string
+	}{
+		{"abc1234", "abc1234"},
+		{"#ABC", "abc"},
+		{" #aBc1 ", "abc1"},
+		{"#", ""},
+	} {
+		out := NormalizeHash(tt.in)
+		if out != tt.out {
+			t.Errorf("NormalizeHash(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestParseFileMultiline(t *testing.T) {
+	in := "2020-01-02T15:04:05Z\tfirst\u2028second\u2028\n"
+	tweets := ParseFile(bufio.NewScanner(strings.NewReader(in)), Tweeter{})
+	if len(tweets) != 1 {
+		t.Fatalf("ParseFile => %d tweets, want 1", len(tweets))
+	}
+	if out := DecodeMultiline(tweets[0].Text); out != "first\nsecond" {
+		t.Errorf("DecodeMultiline(%q) => %q, want %q", tweets[0].Text, out, "first\nsecond")
+	}
+	if out := EncodeMultiline("first\r\nsecond"); out != "first\u2028second" {
+		t.Errorf("EncodeMultiline => %q, want %q", out, "first\u2028second")
+	}
+}
+
+func TestParseUserTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, tt := range []struct {
+		in   string
+		past bool
+		out  time.Time
+	}{
+		{"2h", false, now.Add(2 * time.Hour)},
+		{"2h", true, now.Add(-2 * time.Hour)},
+		{"3d", true, now.AddDate(0, 0, -3)},
+		{"16:00", false, time.Date(2020, 1, 2, 16, 0, 0, 0, time.UTC)},
+		{"16:00", true, time.Date(2020, 1, 1, 16, 0, 0, 0, time.UTC)},
+		{"09:00", false, time.Date(2020, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{"2020-02-01", false, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"2020-02-01 10:30", true, time.Date(2020, 2, 1, 10, 30, 0, 0, time.UTC)},
+	} {
+		out, err := ParseUserTime(tt.in, now, tt.past)
+		if err != nil || !out.Equal(tt.out) {
+			t.Errorf("ParseUserTime(%q) => %v, %v, want %v", tt.in, out, err, tt.out)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	tweet := Tweet{
+		Tweeter: Tweeter{Nick: "alice", URL: "https://example.org/twtxt.txt"},
+		Created: now.Add(-time.Hour),
+		Text:    "Hello @<bob https://example.com/bob.txt>, see #Go and the world",
+	}
+	for _, tt := range []struct {
+		query string
+		match bool
+	}{
+		{"hello", true},
+		{"hello nope", false},
+		{"hel", true},
+		{"ello", false},
+		{`"see #go"`, true},
+		{`"the hello"`, false},
+		{"#go", true},
+		{"#golang", false},
+		{"@bob", true},
+		{"@carol", false},
+		{"from:alice from:carol", true},
+		{"from:carol", false},
+		{"since:2h", true},
+		{"since:30m", false},
+		{"until:30m world", true},
+		{"until:2020-01-01", false},
+	} {
+		q, err := ParseQuery(tt.query, now)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) => %v", tt.query, err)
+		}
+		if match := q.Match(tweet); match != tt.match {
+			t.Errorf("ParseQuery(%q).Match => %v, want %v", tt.query, match, tt.match)
+		}
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	url := "https://example.org/twtxt.txt"
+	tweets := Tweets{
+		{Created: time.Unix(1, 0), Text: "hello world"},
+		{Created: time.Unix(2, 0), Text: "goodbye #world"},
+	}
+	cache := Cache{url: {Tweets: tweets[:1]}}
+	index := make(Index)
+	if !index.Update(cache) {
+		t.Errorf("Update on empty index => false, want true")
+	}
+	cache[url] = Cached{Tweets: tweets}
+	if !index.Update(cache) || index.Update(cache) {
+		t.Errorf("Update did not report appended tweets exactly once")
+	}
+	for _, tt := range []struct {
+		query string
+		out   int
+	}{
+		{"world", 2},
+		{"wor", 2},
+		{"hello", 1},
+		{"#world", 1},
+		{"orld", 0},
+	} {
+		q, _ := ParseQuery(tt.query, time.Now())
+		if out := index[url].Candidates(q); len(out) != tt.out {
+			t.Errorf("Candidates(%q) => %v, want %d", tt.query, out, tt.out)
+		}
+	}
+
+	// An earlier tweet edited, keeping the count and the last tweet
+	edited := Tweets{{Created: time.Unix(1, 0), Text: "zebra"}, tweets[1]}
+	cache[url] = Cached{Tweets: edited}
+	if !index.Update(cache) {
+		t.Errorf("Update after editing an earlier tweet => false, want true")
+	}
+	q, _ := ParseQuery("zebra", time.Now())
+	if out := index[url].Candidates(q); len(out) != 1 || out[0] != 0 {
+		t.Errorf("Candidates(%q) after edit => %v, want [0]", "zebra", out)
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	now := time.Now()
+	tweets := Tweets{
+		{Created: now.Add(-time.Minute), Text: "#go #Twtxt"},
+		{Created: now.Add(-time.Minute), Text: "#twtxt"},
+		{Created: now.Add(-90 * time.Minute), Text: "#go #old"},
+		{Created: now.Add(-3 * time.Hour), Text: "#go #older"},
+	}
+	tags := CountTags(tweets, now, time.Hour)
+	want := []TagCount{{"twtxt", 2, 0}, {"go", 1, 1}}
+	if len(tags) != len(want) {
+		t.Fatalf("CountTags => %v, want %v", tags, want)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("CountTags => %v, want %v", tags, want)
+		}
+	}
+}
+
+func TestFiltersHidden(t *testing.T) {
+	saved := conf
+	defer func() { conf = saved }()
+	conf = Config{Following: map[string]string{"bob": "https://example.com/bob.txt"}}
+
+	now := time.Now()
+	filters := Filters{
+		Mute: map[string]string{
+			"loud":  "",
+			"noisy": now.Add(time.Hour).Format(time.RFC3339),
+			"calm":  now.Add(-time.Hour).Format(time.RFC3339),
+		},
+		Hide:                  []string{`(?i)crypto`},
+		HideTags:              []string{"politics"},
+		HideUnfollowedReplies: true,
+	}
+	for _, tt := range []struct {
+		nick, text string
+		hidden     bool
+	}{
+		{"alice", "hello", false},
+		{"loud", "hello", true},
+		{"noisy", "hello", true},
+		{"calm", "hello", false},
+		{"alice", "about Crypto", true},
+		{"alice", "about #Politics", true},
+		{"alice", "@<carol https://example.net/carol.txt> hi", true},
+		{"alice", "@<bob https://example.com/bob.txt> hi", false},
+		{"alice", "hi @<carol https://example.net/carol.txt>", false},
+	} {
+		tweet := Tweet{Tweeter: Tweeter{Nick: tt.nick}, Text: tt.text}
+		if hidden := filters.Hidden(tweet, now); hidden != tt.hidden {
+			t.Errorf("Hidden(%s: %q) => %v, want %v", tt.nick, tt.text, hidden, tt.hidden)
+		}
+	}
+}
+
+func TestFormatTweet(t *testing.T) {
+	defer func() { tweetTemplate = nil }()
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	tweet := Tweet{
+		Tweeter: Tweeter{Nick: "alice", URL: "https://example.org/twtxt.txt"},
+		Created: now.Add(-2 * time.Hour),
+		Text:    "first second",
+	}
+	for _, tt := range []struct {
+		format, out string
+	}{
+		{"", "> \033[32malice\033[0m (2h ago)\nfirst\nsecond\n"},
+		{`{{.Nick}}:\n{{indent "  " .Text}}\n`, "alice:\n  first\n  second\n"},
+		{`{{date "2006-01-02" .Created}} {{color "red" .Ago}}`, "2020-01-02 \033[31m2h ago\033[0m"},
+	} {
+		if err := SetFormat(tt.format); err != nil {
+			t.Fatalf("SetFormat(%q) => %v", tt.format, err)
+		}
+		out, err := FormatTweet(tweet, now, PrintOptions{})
+		if err != nil || out != tt.out {
+			t.Errorf("FormatTweet with %q => %q, %v, want %q", tt.format, out, err, tt.out)
+		}
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+		err     bool
+	}{
+		{"", "", false},
+		{"red", "31", false},
+		{"Bold  bright-blue", "1;94", false},
+		{"38;5;208 underline", "38;5;208;4", false},
+		{"bright-bold", "", true},
+		{"pink", "", true},
+	} {
+		out, err := parseStyle(tt.in)
+		if out != tt.out || (err != nil) != tt.err {
+			t.Errorf("parseStyle(%q) => %q, %v, want %q", tt.in, out, err, tt.out)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		width int
+		out   string
+	}{
+		{"short one", 20, "short one"},
+		{"the quick brown fox jumps", 10, "the quick\n  brown\n  fox\n  jumps"},
+		{"see https://example.com/a/long/path now", 12, "see\n  https://example.com/a/long/path\n  now"},
+		{"hi @<bob https://bob.example/twtxt.txt> there", 10, "hi\n  @<bob https://bob.example/twtxt.txt>\n  there"},
+		{"abcdefghijklmn", 6, "abcdef\n  ghij\n  klmn"},
+		{"日本語の文章です", 8, "日本語の\n  文章で\n  す"},
+		{"one two\nthree four", 9, "one two\nthree\n  four"},
+		{"no wrapping at all", 0, "no wrapping at all"},
+	} {
+		if out := Wrap(tt.in, tt.width, "  "); out != tt.out {
+			t.Errorf("Wrap(%q, %d) => %q, want %q", tt.in, tt.width, out, tt.out)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	defer func() { timeMode, timeLocation = "relative", time.Local }()
+	timeLocation = time.FixedZone("CET", 3600)
+	now := time.Date(2020, 1, 9, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		mode string
+		age  time.Duration
+		out  string
+	}{
+		{"relative", 2 * time.Hour, "2h ago"},
+		{"absolute", 2 * time.Hour, "2020-01-09 11:00"},
+		{"mixed", 2 * time.Hour, "2h ago"},
+		{"mixed", 8 * 24 * time.Hour, "8d ago, 2020-01-01 13:00"},
+	} {
+		if err := SetTimeMode(tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		v := NewTweetView(Tweet{Created: now.Add(-tt.age)}, now, PrintOptions{})
+		if out := v.Timestamp(); out != tt.out {
+			t.Errorf("Timestamp in %s mode, %s ago => %q, want %q", tt.mode, tt.age, out, tt.out)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"plain text", "plain text"},
+		{"**bold** and _em_ and `x := 1`", "\033[1mbold\033[0m and \033[3mem\033[0m and \033[36mx := 1\033[0m"},
+		{"see [docs](https://example.com/docs/)", "see \033[4mdocs\033[0m (example.com/docs)"},
+		{"![cat](https://example.com/i.png)", "\033[4m[image: cat]\033[0m (example.com/i.png)"},
+		{"https://example.com/a_b_c stays", "https://example.com/a_b_c stays"},
+		{"@<a_b https://example.com/a_b_/twtxt.txt> hi", "@<a_b https://example.com/a_b_/twtxt.txt> hi"},
+		{"snake_case_word", "snake_case_word"},
+	} {
+		if out := RenderMarkdown(tt.in); out != tt.out {
+			t.Errorf("RenderMarkdown(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestCompactURL(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"https://www.example.com/", "example.com"},
+		{"http://example.com/a/b", "example.com/a/b"},
+		{"https://example.com/some/rather/long/path/to/page.html", "example.com/…/page.html"},
+		{"https://example.com/an-extremely-long-single-segment", "example.com/an-extremely-lo…"},
+		{"not a url", "not a url"},
+	} {
+		if out := CompactURL(tt.in); out != tt.out {
+			t.Errorf("CompactURL(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out []string
+	}{
+		{"jk", []string{"j", "k"}},
+		{"\033[A\033OBq", []string{keyUp, keyDown, "q"}},
+		{"\033[6~ä\033", []string{keyPageDown, "ä", "\033"}},
+		{"\033[1~\033[F", []string{keyHome, keyEnd}},
+	} {
+		out := splitKeys(tt.in)
+		if strings.Join(out, "|") != strings.Join(tt.out, "|") {
+			t.Errorf("splitKeys(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestWatchedSchedule(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	var w watched
+	for _, tt := range []struct {
+		news    bool
+		backoff time.Duration
+	}{
+		{false, 5 * time.Minute},
+		{false, 10 * time.Minute},
+		{false, 20 * time.Minute},
+		{false, 30 * time.Minute},
+		{false, 30 * time.Minute},
+		{true, 5 * time.Minute},
+	} {
+		w.schedule(now, tt.news, 5*time.Minute, 30*time.Minute)
+		if w.backoff != tt.backoff || !w.next.Equal(now.Add(tt.backoff)) {
+			t.Errorf("schedule with news %v => %s, want %s", tt.news, w.backoff, tt.backoff)
+		}
+	}
+}
+
+func TestNotifyReason(t *testing.T) {
+	defer func(twturl string) { conf.Twturl = twturl }(conf.Twturl)
+	conf.Twturl = "https://example.org/me.txt"
+	notify := Notify{Mentions: true, Nicks: []string{"Bob"}}
+	for _, tt := range []struct {
+		nick, text, reason string
+	}{
+		{"alice", "hi @<me https://example.org/me.txt>", "mention"},
+		{"alice", "hi @<carol https://example.org/carol.txt>", ""},
+		{"bob", "anything", "nick"},
+	} {
+		tweet := Tweet{Tweeter: Tweeter{Nick: tt.nick}, Text: tt.text}
+		if reason := notify.reason(tweet); reason != tt.reason {
+			t.Errorf("reason for %q by %s => %q, want %q", tt.text, tt.nick, reason, tt.reason)
+		}
+	}
+}
+
+func TestVetTweets(t *testing.T) {
+	defer func(hooks Hooks) { conf.Hooks = hooks }(conf.Hooks)
+	conf.Hooks.Pre = `test "$TWET_TEXT" != nope`
+	tweets := Tweets{{Text: "yes"}, {Text: "nope"}, {Text: "also"}}
+	approved, err := vetTweets("pre-tweet", tweets)
+	if len(approved) != 2 || approved[0].Text != "yes" || approved[1].Text != "also" || err == nil {
+		t.Errorf("vetTweets => %v, %v, want the two not vetoed, and an error", approved, err)
+	}
+	if approved, err = vetTweets("pre-tweet", tweets[:1]); len(approved) != 1 || err != nil {
+		t.Errorf("vetTweets => %v, %v, want it approved", approved, err)
+	}
+}
+
+func TestPostHook(t *testing.T) {
+	defer func(hooks Hooks) { conf.Hooks = hooks }(conf.Hooks)
+	conf.Hooks.Post = `test "$TWET_COUNT" = 2 && test "$TWET_TEXT" = last && test "$(grep -c '"hash"')" = 2`
+	if err := postHook("post-tweet", Tweets{{Text: "first"}, {Text: "last"}}); err != nil {
+		t.Errorf("postHook => %v, want the last tweet, count and both on stdin", err)
+	}
+	if err := postHook("post-tweet", Tweets{{Text: "last"}}); err == nil {
+		t.Errorf("postHook => nil, want an error from the hook")
+	}
+}
+
+func TestSeedRead(t *testing.T) {
+	stored := time.Unix(100, 0)
+	tweets := Tweets{{Created: time.Unix(50, 0), Text: "old"}, {Created: time.Unix(150, 0), Text: "new"}}
+	marked := Cached{Tweets: tweets, Read: ReadMarker{Time: time.Unix(10, 0)}}
+	cache := Cache{"a": {Tweets: tweets}, "b": marked}
+	cache.SeedRead(stored)
+	if unread := cache["a"].Unread(); len(unread) != 1 || unread[0].Text != "new" {
+		t.Errorf("Unread of seeded feed => %v, want only the new tweet", unread)
+	}
+	if unread := cache["b"].Unread(); len(unread) != 2 {
+		t.Errorf("Unread of marked feed => %v, want both, its marker kept", unread)
+	}
+}
+
+func TestMarkSeen(t *testing.T) {
+	var tweets Tweets
+	for i, text := range []string{"a", "b", "c", "d"} {
+		tweets = append(tweets, Tweet{Created: time.Unix(int64(i), 0), Text: text})
+	}
+	for _, tt := range []struct {
+		seen   []int
+		unread string
+	}{
+		{nil, "abcd"},
+		{[]int{2, 3}, "ab"},
+		{[]int{0, 1}, "cd"},
+		{[]int{0, 2}, "bd"},
+		{[]int{0, 1, 2, 3}, ""},
+	} {
+		cache := Cache{"a": {Tweets: tweets}}
+		seen := make(map[string]bool)
+		for _, i := range tt.seen {
+			seen[tweets[i].Hash()] = true
+		}
+		cache.MarkSeen("a", seen)
+		var unread string
+		for _, tweet := range cache["a"].Unread() {
+			unread += tweet.Text
+		}
+		if unread != tt.unread {
+			t.Errorf("Unread after MarkSeen of %v => %q, want %q", tt.seen, unread, tt.unread)
+		}
+	}
+}
+
+func TestLastTweetTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	twtfile := filepath.Join(dir, "twtxt.txt")
+	if last := lastTweetTime(twtfile); !last.IsZero() {
+		t.Errorf("lastTweetTime of missing file => %v, want zero", last)
+	}
+	data := "2020-01-02T10:00:00Z\tlater\n2020-01-01T10:00:00Z\tearlier\n"
+	if err := ioutil.WriteFile(twtfile, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if last := lastTweetTime(twtfile); !last.Equal(time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("lastTweetTime => %v, want the later tweet's", last)
+	}
+}
+
+func TestReplyTemplate(t *testing.T) {
+	defer func(following map[string]string) { conf.Following = following }(conf.Following)
+	conf.Following = map[string]string{"alice": "https://example.org/twtxt.txt"}
+	for _, tweeter := range []Tweeter{
+		{Nick: "alice", URL: "https://example.org/twtxt.txt"},
+		{Nick: "bob", URL: "https://example.com/bob.txt"},
+	} {
+		tweet := Tweet{Tweeter: tweeter, Created: time.Unix(0, 0), Text: "hi"}
+		want := "(#" + tweet.Hash() + ") @alice"
+		if tweeter.Nick == "bob" {
+			want = "(#" + tweet.Hash() + ") @<bob https://example.com/bob.txt>"
+		}
+		if out := replyTemplate(tweet); out != want {
+			t.Errorf("replyTemplate for %s => %q, want %q", tweeter.Nick, out, want)
+		}
+	}
+}
+
+// Sets up conf with a twtfile of many tweets in a temporary directory,
+// returning its path and content.
+func testTwtfile(t *testing.T, dir string) (string, string) {
+	conf.Nick, conf.Twturl = "me", "https://example.org/twtxt.txt"
+	conf.Twtfile = filepath.Join(dir, "twtxt.txt")
+	conf.Hooks = Hooks{}
+	data := "# nick = me\n2020-01-01T10:00:00+01:00   second  tweet\n"
+	for i := 0; i < 40; i++ {
+		data += fmt.Sprintf("2020-01-02T10:%02d:00Z\ttweet %d\n", i, i)
+	}
+	if err := ioutil.WriteFile(conf.Twtfile, []byte(data), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return conf.Twtfile, data
+}
+
+func TestTwtfileFind(t *testing.T) {
+	defer func(c Config) { conf = c }(conf)
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testTwtfile(t, dir)
+	tf, err := readTwtfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Of 40 hashes, some must start alike
+	byStart := make(map[string]int)
+	var ambiguous string
+	for _, line := range tf.lines {
+		if tweet, ok := ParseLine(line, Tweeter{URL: conf.Twturl}); ok {
+			if byStart[tweet.Hash()[:1]]++; byStart[tweet.Hash()[:1]] == 2 {
+				ambiguous = tweet.Hash()[:1]
+			}
+		}
+	}
+	second, _ := ParseLine(tf.lines[1], Tweeter{URL: conf.Twturl})
+	for _, tt := range []struct {
+		hash string
+		line int // -1 for an error
+	}{
+		{second.Hash(), 1},
+		{"#" + strings.ToUpper(second.Hash()[:6]), 1},
+		{ambiguous, -1},
+		{"1", -1}, // not in the base32 alphabet
+		{"#", -1},
+	} {
+		i, tweet, err := tf.find(tt.hash)
+		if tt.line == -1 {
+			if err == nil {
+				t.Errorf("find(%q) => line %d, want an error", tt.hash, i)
+			}
+			continue
+		}
+		if err != nil || i != tt.line || tweet.Text != "second  tweet" {
+			t.Errorf("find(%q) => %d, %q, %v, want line %d", tt.hash, i, tweet.Text, err, tt.line)
+		}
+	}
+}
+
+func TestDeleteCommand(t *testing.T) {
+	defer func(c Config) { conf = c }(conf)
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	twtfile, data := testTwtfile(t, dir)
+	lines := strings.SplitAfter(data, "\n")
+	first, _ := ParseLine(strings.TrimSpace(lines[2]), Tweeter{URL: conf.Twturl})
+	last, _ := ParseLine(strings.TrimSpace(lines[len(lines)-2]), Tweeter{URL: conf.Twturl})
+	if err := DeleteCommand([]string{first.Hash(), "#" + strings.ToUpper(last.Hash())}); err != nil {
+		t.Fatalf("DeleteCommand => %v", err)
+	}
+	want := strings.Join(lines[:2], "") + strings.Join(lines[3:len(lines)-2], "")
+	if got, _ := ioutil.ReadFile(twtfile); string(got) != want {
+		t.Errorf("twtfile after delete => %q, want %q", got, want)
+	}
+	if bak, _ := ioutil.ReadFile(twtfile + ".bak"); string(bak) != data {
+		t.Errorf("backup after delete => %q, want the original", bak)
+	}
+	if fi, err := os.Stat(twtfile); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0640 {
+		t.Errorf("mode after delete => %v, want 0640 kept", fi.Mode())
+	}
+}
+
+func TestEditCommand(t *testing.T) {
+	defer func(c Config) { conf = c }(conf)
+	defer os.Setenv("EDITOR", os.Getenv("EDITOR"))
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	twtfile, data := testTwtfile(t, dir)
+	lines := strings.SplitAfter(data, "\n")
+	second, _ := ParseLine(strings.TrimSpace(lines[1]), Tweeter{URL: conf.Twturl})
+	os.Setenv("EDITOR", "sed -i s/second/2nd/")
+	if err := EditCommand([]string{second.Hash()}); err != nil {
+		t.Fatalf("EditCommand => %v", err)
+	}
+	want := lines[0] + "2020-01-01T10:00:00+01:00   2nd  tweet\n" + strings.Join(lines[2:], "")
+	if got, _ := ioutil.ReadFile(twtfile); string(got) != want {
+		t.Errorf("twtfile after edit => %q, want %q", got, want)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	if err := writeFileAtomic(path, []byte("one\n"), true); err != nil {
+		t.Fatalf("writeFileAtomic of new file => %v", err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("backup of new file => %v, want none", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("two\n"), true); err != nil {
+		t.Fatalf("writeFileAtomic => %v", err)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "two\n" {
+		t.Errorf("file => %q, want %q", got, "two\n")
+	}
+	if bak, _ := ioutil.ReadFile(path + ".bak"); string(bak) != "one\n" {
+		t.Errorf("backup => %q, want %q", bak, "one\n")
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode => %v, want 0600 kept", fi.Mode())
+	}
+	// No temporary files left behind
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("files in dir => %d, want the file and its backup", len(files))
+	}
+}
+
+func TestUseProfileWrite(t *testing.T) {
+	defer func(c Config) { conf = c }(conf)
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := Hooks{Post: "base post"}
+	conf = Config{
+		Nick: "me", Twturl: "https://example.org/me.txt", Twtfile: "~/me.txt", Hooks: base,
+		Profiles: map[string]Profile{
+			"proj": {Nick: "proj", Twturl: "https://example.org/proj.txt", Twtfile: "~/proj.txt",
+				Hooks: Hooks{Pre: "proj pre"}},
+		},
+		path: filepath.Join(dir, "config.yaml"),
+	}
+	if err := conf.UseProfile("proj"); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Nick != "proj" || conf.Twtfile != "~/proj.txt" || conf.Hooks.Post != "" {
+		t.Errorf("UseProfile => %s %s %+v, want the profile's", conf.Nick, conf.Twtfile, conf.Hooks)
+	}
+	if !conf.IsOwnURL("https://example.org/me.txt") || !conf.IsOwnURL("https://example.org/proj.txt") {
+		t.Errorf("IsOwnURL => false, want true for both identities")
+	}
+	if err := conf.Write(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(conf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written Config
+	if err := written.Parse(data); err != nil {
+		t.Fatal(err)
+	}
+	if written.Nick != "me" || written.Twturl != "https://example.org/me.txt" ||
+		written.Twtfile != "~/me.txt" || written.Hooks != base {
+		t.Errorf("written config => %s %s %s %+v, want the base identity",
+			written.Nick, written.Twturl, written.Twtfile, written.Hooks)
+	}
+	if p := written.Profiles["proj"]; p.Nick != "proj" || p.Hooks.Pre != "proj pre" {
+		t.Errorf("written profile => %+v, want it kept", p)
+	}
+	// And back
+	if err := conf.UseProfile(""); err != nil || conf.Nick != "me" || conf.Hooks != base {
+		t.Errorf("UseProfile(\"\") => %v, %s %+v, want the base identity", err, conf.Nick, conf.Hooks)
+	}
+}
+
+func TestHighlighter(t *testing.T) {
+	q, err := ParseQuery("ello wor #go", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := highlight
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"hello yellow world", "hello yellow " + h("wor") + "ld"},
+		{"Ello, (ello) #go #gopher", h("Ello") + ", (" + h("ello") + ") " + h("#go") + " #gopher"},
+		{"\033[32mello\033[0mello", "\033[32m" + h("ello") + "\033[0m" + h("ello")},
+	} {
+		if out := Highlight(tt.in, q.Highlighter()); out != tt.out {
+			t.Errorf("Highlight(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestDeleteCommandVeto(t *testing.T) {
+	defer func(c Config) { conf = c }(conf)
+	dir, err := ioutil.TempDir("", "twet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	twtfile, data := testTwtfile(t, dir)
+	lines := strings.SplitAfter(data, "\n")
+	keep, _ := ParseLine(strings.TrimSpace(lines[2]), Tweeter{URL: conf.Twturl})
+	drop, _ := ParseLine(strings.TrimSpace(lines[3]), Tweeter{URL: conf.Twturl})
+	conf.Hooks.Pre = `test "$TWET_EVENT $TWET_HASH" != "pre-delete ` + keep.Hash() + `"`
+	if err := DeleteCommand([]string{keep.Hash(), drop.Hash()}); err == nil {
+		t.Errorf("DeleteCommand => nil, want the veto")
+	}
+	want := strings.Join(lines[:3], "") + strings.Join(lines[4:], "")
+	if got, _ := ioutil.ReadFile(twtfile); string(got) != want {
+		t.Errorf("twtfile after delete => %q, want only the tweet not vetoed gone", got)
+	}
+}
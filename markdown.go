@@ -0,0 +1,105 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Whether to render Markdown, as set by -markdown on the command line,
+// overriding the config.
+var markdownFlag bool
+var markdownFlagSet bool
+
+func markdownEnabled() bool {
+	if markdownFlagSet {
+		return markdownFlag
+	}
+	return conf.Markdown
+}
+
+// The Markdown understood, in order of precedence. Mentions and bare URLs
+// are matched only to be left alone, so that no emphasis is found inside
+// them.
+var markdownRE = regexp.MustCompile(
+	`!\[([^\]]*)\]\(([^)\s]+)\)` + // 1, 2: image
+		`|\[([^\]]+)\]\(([^)\s]+)\)` + // 3, 4: link
+		"|`([^`]+)`" + // 5: code
+		`|@<[^>]*>` + // mention
+		`|[a-z][a-z0-9+.-]*://\S+` + // bare URL
+		`|\*\*([^*]+)\*\*|__([^_]+)__` + // 6, 7: strong
+		`|\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b` + // 8, 9: emphasis
+		`|~~([^~]+)~~`) // 10: strikethrough
+
+// Renders the Markdown in text as terminal styling: emphasis, code and
+// links by the theme, and link targets shortened, or as hyperlinks (OSC 8)
+// if configured so.
+func RenderMarkdown(text string) string {
+	return markdownRE.ReplaceAllStringFunc(text, func(match string) string {
+		m := markdownRE.FindStringSubmatch(match)
+		switch {
+		case strings.HasPrefix(match, "!["):
+			alt := "image"
+			if m[1] != "" {
+				alt = "image: " + m[1]
+			}
+			return renderLink("["+alt+"]", m[2])
+		case m[4] != "":
+			return renderLink(m[3], m[4])
+		case m[5] != "":
+			return themed("code", m[5])
+		case m[6] != "" || m[7] != "":
+			return sgr("1", m[6]+m[7])
+		case m[8] != "" || m[9] != "":
+			return sgr("3", m[8]+m[9])
+		case m[10] != "":
+			return sgr("9", m[10])
+		}
+		return match
+	})
+}
+
+func renderLink(text, target string) string {
+	if conf.Hyperlinks && colorEnabled {
+		return Hyperlink(target, themed("link", text))
+	}
+	if text == target {
+		return themed("link", CompactURL(target))
+	}
+	return themed("link", text) + " (" + CompactURL(target) + ")"
+}
+
+// Makes text a hyperlink to target, for terminals understanding OSC 8.
+// Others show just text.
+func Hyperlink(target, text string) string {
+	return "\033]8;;" + target + "\033\\" + text + "\033]8;;\033\\"
+}
+
+const compactURLMax = 30
+
+// Shortens a URL for showing: no scheme or www., and if still long, only
+// the host and the last part of the path.
+func CompactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	path := strings.TrimSuffix(u.Path, "/")
+	if len([]rune(host+path)) <= compactURLMax {
+		return host + path
+	}
+	last := path[strings.LastIndex(path, "/")+1:]
+	if r := []rune(last); len(r) > compactURLMax/2 {
+		last = string(r[:compactURLMax/2]) + "…"
+	}
+	switch {
+	case last == "":
+		return host
+	case strings.Count(path, "/") == 1:
+		return host + "/" + last
+	}
+	return host + "/…/" + last
+}
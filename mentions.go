@@ -0,0 +1,177 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hashes of the mentions we've already been shown are kept next to the cache,
+// one per line.
+func seenMentionsFile(configpath string) string {
+	return fmt.Sprintf("%s/mentions", configpath)
+}
+
+func LoadSeenMentions(configpath string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	data, err := ioutil.ReadFile(seenMentionsFile(configpath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return seen, nil
+		}
+		return nil, err
+	}
+	for _, hash := range strings.Fields(string(data)) {
+		seen[hash] = true
+	}
+	return seen, nil
+}
+
+func StoreSeenMentions(configpath string, seen map[string]bool) error {
+	var hashes []string
+	for hash := range seen {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	data := strings.Join(hashes, "\n") + "\n"
+	return ioutil.WriteFile(seenMentionsFile(configpath), []byte(data), 0666)
+}
+
+// Returns the tweets mentioning one of our identities.
+func Mentioning(tweets Tweets) Tweets {
+	var mentioning Tweets
+	for _, tweet := range tweets {
+		for _, m := range tweet.Mentions() {
+			if conf.IsOwnURL(m.URL) {
+				mentioning = append(mentioning, tweet)
+				break
+			}
+		}
+	}
+	return mentioning
+}
+
+// Returns the feeds mentioned in tweets that aren't among sources (nor ours),
+// keyed by the nick they were mentioned as (or the URL, if that's taken or
+// missing).
+func DiscoveredFeeds(tweets Tweets, sources map[string]string) map[string]string {
+	known := make(map[string]bool)
+	for _, url := range sources {
+		known[NormalizeURL(url)] = true
+	}
+
+	discovered := make(map[string]string)
+	for _, tweet := range tweets {
+		for _, m := range tweet.Mentions() {
+			norm := NormalizeURL(m.URL)
+			if norm == "" || known[norm] || conf.IsOwnURL(m.URL) {
+				continue
+			}
+			known[norm] = true
+			nick := m.Nick
+			if _, taken := sources[nick]; taken || nick == "" {
+				nick = m.URL
+			}
+			if _, taken := discovered[nick]; taken {
+				nick = m.URL
+			}
+			discovered[nick] = m.URL
+		}
+	}
+	return discovered
+}
+
+func MentionsCommand(args []string) error {
+	fs := flag.NewFlagSet("mentions", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	unseenFlag := fs.Bool("u", false, "only show mentions not seen before")
+	discoverFlag := fs.Bool("a", false, "also fetch feeds mentioned in cached tweets that we don't follow")
+	dryFlag := fs.Bool("n", false, "dry-run, only locally cached tweets")
+	rawFlag := fs.Bool("r", false, "output tweets in URL-prefixed twtxt format")
+	jsonFlag := fs.Bool("json", false, "output tweets as JSON, one object per line")
+	formatFlag := fs.String("format", "", "print tweets in `format`, named in config or a template")
+	reversedFlag := fs.Bool("desc", false, "tweets shown in descending order (newer tweets at top)")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s mentions [arguments]
+
+Displays tweets mentioning you (the twturl of any of your profiles).
+Mentions that haven't been shown before are marked as new. Cached tweets of
+feeds you don't follow are included too.
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+	if *formatFlag != "" {
+		if err := SetFormat(*formatFlag); err != nil {
+			return err
+		}
+	}
+	if conf.Twturl == "" {
+		return fmt.Errorf("cannot find mentions without twturl set in config")
+	}
+
+	cache := LoadCache(configpath)
+	if !*dryFlag {
+		sources := followedSources()
+		if *discoverFlag {
+			for nick, url := range DiscoveredFeeds(cache.GetAll(), sources) {
+				sources[nick] = url
+			}
+		}
+		cache.FetchTweets(sources)
+		cache.Store(configpath)
+	}
+
+	seen, err := LoadSeenMentions(configpath)
+	if err != nil {
+		return fmt.Errorf("error loading seen mentions: %s", err)
+	}
+
+	now := time.Now()
+	tweets := Mentioning(cache.GetAll().Filter(&conf.Filters, now))
+	if *reversedFlag {
+		sort.Sort(sort.Reverse(tweets))
+	} else {
+		sort.Sort(tweets)
+	}
+
+	defer StartPager()()
+	for _, tweet := range tweets {
+		hash := tweet.Hash()
+		isnew := !seen[hash]
+		if *unseenFlag && !isnew {
+			continue
+		}
+		switch {
+		case *jsonFlag:
+			PrintTweetJSON(tweet, PrintOptions{New: isnew})
+		case *rawFlag:
+			PrintTweetRaw(tweet)
+			fmt.Println()
+		default:
+			PrintTweetWith(tweet, now, PrintOptions{New: isnew})
+		}
+		seen[hash] = true
+	}
+
+	if err := StoreSeenMentions(configpath, seen); err != nil {
+		return fmt.Errorf("error storing seen mentions: %s", err)
+	}
+	return nil
+}
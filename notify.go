@@ -0,0 +1,77 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+// What to be notified about, and how.
+type Notify struct {
+	Command  string   // shell command, given the tweet in environment and as JSON on stdin
+	Mentions bool     // notify of tweets mentioning us
+	Nicks    []string // notify of all tweets by these
+}
+
+// Why a tweet is notified about, if at all: "mention" or "nick".
+func (notify *Notify) reason(tweet Tweet) string {
+	if notify.Mentions {
+		for _, m := range tweet.Mentions() {
+			if conf.IsOwnURL(m.URL) {
+				return "mention"
+			}
+		}
+	}
+	for _, nick := range notify.Nicks {
+		if strings.EqualFold(nick, tweet.Tweeter.Nick) {
+			return "nick"
+		}
+	}
+	return ""
+}
+
+// The environment a command gets about tweet.
+func tweetEnv(tweet Tweet) []string {
+	return []string{
+		"TWET_NICK=" + tweet.Tweeter.Nick,
+		"TWET_URL=" + tweet.Tweeter.URL,
+		"TWET_HASH=" + tweet.Hash(),
+		"TWET_CREATED=" + tweet.Created.Format(time.RFC3339),
+		"TWET_TEXT=" + DecodeMultiline(tweet.Text),
+	}
+}
+
+// Runs the notify command for each of the tweets (newly arrived) that is
+// to be notified about, with TWET_REASON and tweetEnv set. Our own tweets,
+// and those muted or hidden, are left out.
+func NotifyTweets(tweets Tweets) {
+	notify := &conf.Notify
+	if notify.Command == "" {
+		return
+	}
+	now := time.Now()
+	for _, tweet := range tweets.Filter(&conf.Filters, now) {
+		if conf.IsOwnURL(tweet.Tweeter.URL) {
+			continue
+		}
+		reason := notify.reason(tweet)
+		if reason == "" {
+			continue
+		}
+		var data bytes.Buffer
+		enc := json.NewEncoder(&data)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(NewJSONTweet(tweet, PrintOptions{New: true})); err != nil {
+			log.Printf("error encoding tweet for notification: %s", err)
+			continue
+		}
+		env := append(tweetEnv(tweet), "TWET_REASON="+reason)
+		if _, err := execShellWith(homedir, notify.Command, env, &data); err != nil {
+			log.Printf("error executing notify command: %s", err)
+		}
+	}
+}
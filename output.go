@@ -3,7 +3,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
+	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -12,19 +15,23 @@ import (
 )
 
 func red(s string) string {
-	return fmt.Sprintf("\033[31m%s\033[0m", s)
+	return sgr("31", s)
 }
 func green(s string) string {
-	return fmt.Sprintf("\033[32m%s\033[0m", s)
+	return sgr("32", s)
 }
 func yellow(s string) string {
-	return fmt.Sprintf("\033[33m%s\033[0m", s)
+	return sgr("33", s)
 }
 func boldgreen(s string) string {
-	return fmt.Sprintf("\033[32;1m%s\033[0m", s)
+	return sgr("32;1", s)
 }
 func blue(s string) string {
-	return fmt.Sprintf("\033[34m%s\033[0m", s)
+	return sgr("34", s)
+}
+
+func reverse(s string) string {
+	return sgr("7", s)
 }
 
 func PrintFollowee(nick, url string) {
@@ -38,17 +45,62 @@ func PrintFolloweeRaw(nick, url string) {
 	fmt.Printf("%s: %s\n", nick, url)
 }
 
+// Extras for PrintTweetWith.
+type PrintOptions struct {
+	Highlight *regexp.Regexp // parts of the text to highlight
+	New       bool           // mark the tweet as new
+}
+
 func PrintTweet(tweet Tweet, now time.Time) {
-	text := ShortenMentions(tweet.Text)
+	PrintTweetWith(tweet, now, PrintOptions{})
+}
+
+func PrintTweetWith(tweet Tweet, now time.Time, opts PrintOptions) {
+	out, err := FormatTweet(tweet, now, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(out)
+}
+
+func highlight(s string) string {
+	return themed("highlight", s)
+}
 
-	nick := green(tweet.Tweeter.Nick)
-	if NormalizeURL(tweet.Tweeter.URL) == NormalizeURL(conf.Twturl) {
-		nick = boldgreen(tweet.Tweeter.Nick)
+// Colour escapes, and hyperlinks (see Hyperlink).
+var ansiRE = regexp.MustCompile("\033\\[[0-9;]*m|\033\\]8;[^\033]*\033\\\\")
+
+// Highlights the matches of re in text, leaving any colour escapes alone. If
+// re has groups, only the first taking part in a match is highlighted.
+func Highlight(text string, re *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range ansiRE.FindAllStringIndex(text, -1) {
+		b.WriteString(highlightMatches(text[last:loc[0]], re))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
 	}
-	fmt.Printf("> %s (%s)\n%s\n",
-		nick,
-		PrettyDuration(now.Sub(tweet.Created)),
-		text)
+	b.WriteString(highlightMatches(text[last:], re))
+	return b.String()
+}
+
+func highlightMatches(s string, re *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		for i := 2; i < len(loc); i += 2 {
+			if loc[i] >= 0 {
+				start, end = loc[i], loc[i+1]
+				break
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(highlight(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
 }
 
 func PrintTweetRaw(tweet Tweet) {
@@ -58,6 +110,47 @@ func PrintTweetRaw(tweet Tweet) {
 		tweet.Text)
 }
 
+// A tweet as output by PrintTweetJSON.
+type JSONTweet struct {
+	Nick     string    `json:"nick"`
+	URL      string    `json:"url"`
+	Created  time.Time `json:"created"`
+	Hash     string    `json:"hash"`
+	Text     string    `json:"text"`
+	Mentions []Tweeter `json:"mentions,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	New      bool      `json:"new,omitempty"`
+}
+
+// Prints v as JSON on a line of its own (for NDJSON streams).
+func PrintJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Printf("error encoding json: %s", err)
+	}
+}
+
+func PrintTweetJSON(tweet Tweet, opts PrintOptions) {
+	PrintJSON(NewJSONTweet(tweet, opts))
+}
+
+func NewJSONTweet(tweet Tweet, opts PrintOptions) JSONTweet {
+	jt := JSONTweet{
+		Nick:     tweet.Tweeter.Nick,
+		URL:      tweet.Tweeter.URL,
+		Created:  tweet.Created,
+		Hash:     tweet.Hash(),
+		Text:     DecodeMultiline(tweet.Text),
+		Mentions: tweet.Mentions(),
+		New:      opts.New,
+	}
+	for _, tag := range tagRE.FindAllString(tweet.Text, -1) {
+		jt.Tags = append(jt.Tags, tag[1:])
+	}
+	return jt
+}
+
 // Turns "@<nick URL>" into "@nick" if we're following URL (or it's us!). If
 // we're following as another nick then "@nick(followednick)".
 func ShortenMentions(text string) string {
@@ -101,10 +194,10 @@ func FormatMention(nick, url, followednick string) string {
 	if followednick != nick {
 		str += fmt.Sprintf("(%s)", followednick)
 	}
-	if NormalizeURL(url) == NormalizeURL(conf.Twturl) {
-		return red(str)
+	if conf.IsOwnURL(url) {
+		return themed("mentionme", str)
 	}
-	return blue(str)
+	return themed("mention", str)
 }
 
 func PrettyDuration(duration time.Duration) string {
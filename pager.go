@@ -0,0 +1,71 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+)
+
+// Whether to page output, as set by -pager on the command line, overriding
+// the config.
+var pagerFlag bool
+var pagerFlagSet bool
+
+// Stdout as twet was started with, before any pager taking it over.
+var termOut = os.Stdout
+
+const defaultPager = "less -R"
+
+// Pipes stdout through $PAGER (or less -R), if paging is on and
+// stdout is a terminal. Call the returned function when done writing, to
+// wait for the pager to be quit.
+func StartPager() func() {
+	nothing := func() {}
+	enabled := conf.Pager
+	if pagerFlagSet {
+		enabled = pagerFlag
+	}
+	if !enabled || !isTerminal(termOut) {
+		return nothing
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = defaultPager
+	}
+	if pager == "cat" {
+		return nothing
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Printf("error starting pager: %s", err)
+		return nothing
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = r
+	cmd.Stdout = termOut
+	cmd.Stderr = os.Stderr
+	// Like git: less quitting at once when all fits on screen, and keeping
+	// colours, unless told otherwise
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("error starting pager: %s", err)
+		r.Close()
+		w.Close()
+		return nothing
+	}
+	r.Close()
+	os.Stdout = w
+
+	return func() {
+		os.Stdout = termOut
+		w.Close()
+		if err := cmd.Wait(); err != nil && debug {
+			log.Printf("pager: %s", err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The queue of scheduled tweets is kept next to the cache, in twtxt format.
+// Each profile has its own.
+func queueFile(configpath string) string {
+	if conf.profile != "" {
+		return fmt.Sprintf("%s/queue-%s", configpath, conf.profile)
+	}
+	return fmt.Sprintf("%s/queue", configpath)
+}
+
+func LoadQueue(configpath string) (Tweets, error) {
+	f, err := os.Open(queueFile(configpath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Tweets{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	queue := ParseFile(bufio.NewScanner(f), Tweeter{Nick: conf.Nick, URL: conf.Twturl})
+	sort.Stable(queue)
+	return queue, nil
+}
+
+func StoreQueue(configpath string, queue Tweets) error {
+	sort.Stable(queue)
+	var data string
+	for _, tweet := range queue {
+		data += fmt.Sprintf("%s\t%s\n", tweet.Created.Format(time.RFC3339), tweet.Text)
+	}
+	return ioutil.WriteFile(queueFile(configpath), []byte(data), 0666)
+}
+
+func QueueCommand(args []string) error {
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s queue [list]
+   or: %s queue cancel <number>...
+   or: %s queue flush
+
+Manages tweets scheduled with "%s tweet -at". "list" shows the queue, numbered
+in order of time. "cancel" removes tweets from the queue by number. "flush"
+appends all tweets that are due to the twtfile, running the pre hook for each
+and the post hook once; run it regularly, for example from cron.
+
+Each profile has a queue of its own, managed with "%s -p <profile> queue".
+Without -p, flush goes through the queues of all profiles, each into its own
+twtfile with its own hooks.
+`, progname, progname, progname, progname, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+
+	if fs.Arg(0) == "flush" {
+		if fs.NArg() > 1 {
+			return fmt.Errorf("too many arguments given")
+		}
+		if profile != "" || len(conf.Profiles) == 0 {
+			return flushQueue(configpath)
+		}
+		names := []string{""}
+		for name := range conf.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var failed error
+		for _, name := range names {
+			if err := conf.UseProfile(name); err != nil {
+				return err
+			}
+			if err := flushQueue(configpath); err != nil {
+				if name != "" {
+					err = fmt.Errorf("profile %s: %s", name, err)
+				}
+				log.Print(err)
+				failed = fmt.Errorf("flushing failed for some queues")
+			}
+		}
+		return failed
+	}
+
+	queue, err := LoadQueue(configpath)
+	if err != nil {
+		return fmt.Errorf("error loading queue: %s", err)
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		if fs.NArg() > 1 {
+			return fmt.Errorf("too many arguments given")
+		}
+		for i, tweet := range queue {
+			fmt.Printf("%d: %s\t%s\n", i+1, tweet.Created.Format(time.RFC3339), tweet.Text)
+		}
+	case "cancel":
+		if fs.NArg() < 2 {
+			return fmt.Errorf("too few arguments given")
+		}
+		cancel := make(map[int]bool)
+		for _, arg := range fs.Args()[1:] {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(queue) {
+				return fmt.Errorf("no queued tweet with number %q", arg)
+			}
+			cancel[n-1] = true
+		}
+		var kept Tweets
+		for i, tweet := range queue {
+			if !cancel[i] {
+				kept = append(kept, tweet)
+			}
+		}
+		if err := StoreQueue(configpath, kept); err != nil {
+			return fmt.Errorf("error storing queue: %s", err)
+		}
+		fmt.Printf("%s cancelled %d queued tweet(s)\n", yellow("✓"), len(cancel))
+	default:
+		return fmt.Errorf("unknown queue command %q", fs.Arg(0))
+	}
+
+	return nil
+}
+
+// Appends the tweets of the queue that are due to the twtfile, running the
+// hooks around them. Vetoed tweets are kept in the queue.
+func flushQueue(configpath string) error {
+	queue, err := LoadQueue(configpath)
+	if err != nil {
+		return fmt.Errorf("error loading queue: %s", err)
+	}
+	now := time.Now()
+	var due, kept Tweets
+	for _, tweet := range queue {
+		if tweet.Created.After(now) {
+			kept = append(kept, tweet)
+		} else {
+			due = append(due, tweet)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	twtfile, err := conf.TwtfilePath()
+	if err != nil {
+		return err
+	}
+	approved, veto := vetTweets("pre-tweet", due)
+	if len(approved) > 0 {
+		if err := AppendTweets(twtfile, approved); err != nil {
+			return err
+		}
+	}
+	// Keeping vetoed tweets queued, for another try
+	appended := make(map[string]bool)
+	for _, tweet := range approved {
+		appended[tweet.Hash()] = true
+	}
+	for _, tweet := range due {
+		if !appended[tweet.Hash()] {
+			kept = append(kept, tweet)
+		}
+	}
+	if err := StoreQueue(configpath, kept); err != nil {
+		return fmt.Errorf("error storing queue: %s", err)
+	}
+	if err := postHook("post-tweet", approved); err != nil {
+		return err
+	}
+	return veto
+}
@@ -0,0 +1,249 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A parsed search query. A tweet matches if it was posted by any of the From
+// nicks (if given) and matches all other criteria.
+type Query struct {
+	Words    []string // lowercased words and phrases
+	From     []string // nicks
+	Tags     []string // without #
+	Mentions []string // nicks, without @
+	Since    time.Time
+	Until    time.Time
+	wordREs  []*regexp.Regexp
+}
+
+// Splits on spaces, except within double quotes. Quoted tokens are reported
+// as such, so that they can be taken literally.
+func splitQuery(query string) (tokens []string, quoted []bool) {
+	var token strings.Builder
+	inquote, wasquoted := false, false
+	flush := func() {
+		if token.Len() > 0 || wasquoted {
+			tokens = append(tokens, token.String())
+			quoted = append(quoted, wasquoted)
+		}
+		token.Reset()
+		wasquoted = false
+	}
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inquote = !inquote
+			wasquoted = true
+		case !inquote && (r == ' ' || r == '\t'):
+			flush()
+		default:
+			token.WriteRune(r)
+		}
+	}
+	flush()
+	return
+}
+
+func ParseQuery(query string, now time.Time) (Query, error) {
+	var q Query
+	tokens, quoted := splitQuery(query)
+	for i, token := range tokens {
+		if token == "" {
+			continue
+		}
+		lower := strings.ToLower(token)
+		switch {
+		case quoted[i]:
+			q.Words = append(q.Words, lower)
+		case strings.HasPrefix(lower, "from:"):
+			q.From = append(q.From, strings.TrimPrefix(token, "from:"))
+		case strings.HasPrefix(lower, "since:"), strings.HasPrefix(lower, "until:"):
+			tm, err := ParseUserTime(token[len("since:"):], now, true)
+			if err != nil {
+				return q, err
+			}
+			if strings.HasPrefix(lower, "since:") {
+				q.Since = tm
+			} else {
+				q.Until = tm
+			}
+		case len(token) > 1 && token[0] == '#':
+			q.Tags = append(q.Tags, lower[1:])
+		case len(token) > 1 && token[0] == '@':
+			q.Mentions = append(q.Mentions, token[1:])
+		default:
+			q.Words = append(q.Words, lower)
+		}
+	}
+	for _, word := range q.Words {
+		q.wordREs = append(q.wordREs,
+			regexp.MustCompile(`(?:^|[^\pL\pN_])`+regexp.QuoteMeta(word)))
+	}
+	return q, nil
+}
+
+func (q Query) Match(tweet Tweet) bool {
+	if !q.Since.IsZero() && tweet.Created.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !tweet.Created.Before(q.Until) {
+		return false
+	}
+	if len(q.From) > 0 {
+		from := false
+		for _, nick := range q.From {
+			if strings.EqualFold(nick, tweet.Tweeter.Nick) {
+				from = true
+				break
+			}
+		}
+		if !from {
+			return false
+		}
+	}
+
+	text := strings.ToLower(DecodeMultiline(tweet.Text))
+	for _, re := range q.wordREs {
+		if !re.MatchString(text) {
+			return false
+		}
+	}
+	for _, tag := range q.Tags {
+		if !tweet.HasTag(tag) {
+			return false
+		}
+	}
+	for _, nick := range q.Mentions {
+		if !mentions(tweet, nick) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tells whether the tweet mentions nick, either by "@<nick URL>", by the URL
+// we know nick by, or by a plain "@nick".
+func mentions(tweet Tweet, nick string) bool {
+	url := conf.Following[nick]
+	if url == "" && strings.EqualFold(nick, conf.Nick) {
+		url = conf.Twturl
+	}
+	for _, m := range tweet.Mentions() {
+		if strings.EqualFold(m.Nick, nick) {
+			return true
+		}
+		if url != "" && NormalizeURL(m.URL) == NormalizeURL(url) {
+			return true
+		}
+	}
+	re := regexp.MustCompile(`(?i)(^|[^<\w])@` + regexp.QuoteMeta(nick) + `\b`)
+	return re.MatchString(tweet.Text)
+}
+
+// Returns a regexp matching the words (at the start of a word, as Match does)
+// and tags of the query, for highlighting. What to highlight is in its first
+// group taking part in a match. Returns nil if there's nothing to highlight.
+func (q Query) Highlighter() *regexp.Regexp {
+	var alts []string
+	if len(q.Words) > 0 {
+		var words []string
+		for _, word := range q.Words {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+		alts = append(alts, `(?:^|[^\pL\pN_])(`+strings.Join(words, "|")+`)`)
+	}
+	for _, tag := range q.Tags {
+		alts = append(alts, "(#"+regexp.QuoteMeta(tag)+`\b)`)
+	}
+	if len(alts) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(alts, "|"))
+}
+
+func SearchCommand(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	rawFlag := fs.Bool("r", false, "output tweets in URL-prefixed twtxt format")
+	jsonFlag := fs.Bool("json", false, "output tweets as JSON, one object per line")
+	formatFlag := fs.String("format", "", "print tweets in `format`, named in config or a template")
+	reversedFlag := fs.Bool("desc", false, "tweets shown in descending order (newer tweets at top)")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s search [arguments] <query>
+
+Searches the locally cached tweets. The query is made of terms which all have
+to match:
+
+  word          tweet contains a word starting with word (case insensitive)
+  "some words"  tweet contains the phrase (likewise at start of a word)
+  #tag          tweet is tagged with tag
+  @nick         tweet mentions nick
+  from:nick     tweet is by nick (several from: match either nick)
+  since:time    tweet is newer than time (like 2w, 3d, 2006-01-02)
+  until:time    tweet is older than time
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("too few arguments given")
+	}
+	if *formatFlag != "" {
+		if err := SetFormat(*formatFlag); err != nil {
+			return err
+		}
+	}
+
+	// An argument with spaces was quoted on the command line, it's a phrase
+	var terms []string
+	for _, arg := range fs.Args() {
+		if strings.ContainsAny(arg, " \t") && !strings.Contains(arg, `"`) {
+			arg = `"` + arg + `"`
+		}
+		terms = append(terms, arg)
+	}
+
+	now := time.Now()
+	query, err := ParseQuery(strings.Join(terms, " "), now)
+	if err != nil {
+		return err
+	}
+
+	tweets := LoadCache(configpath).Search(configpath, query).Filter(&conf.Filters, now)
+	if *reversedFlag {
+		sort.Sort(sort.Reverse(tweets))
+	} else {
+		sort.Sort(tweets)
+	}
+
+	opts := PrintOptions{Highlight: query.Highlighter()}
+	defer StartPager()()
+	for _, tweet := range tweets {
+		switch {
+		case *jsonFlag:
+			PrintTweetJSON(tweet, PrintOptions{})
+		case *rawFlag:
+			PrintTweetRaw(tweet)
+			fmt.Println()
+		default:
+			PrintTweetWith(tweet, now, opts)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Status struct {
+	Profile        string     `json:"profile,omitempty"`
+	Nick           string     `json:"nick"`
+	Twturl         string     `json:"twturl"`
+	Twtfile        string     `json:"twtfile"`
+	Config         string     `json:"config"`
+	Following      int        `json:"following"`
+	Lists          int        `json:"lists"`
+	CachedFeeds    int        `json:"cached_feeds"`
+	CachedTweets   int        `json:"cached_tweets"`
+	Unread         int        `json:"unread"`
+	UnseenMentions int        `json:"unseen_mentions"`
+	Queued         int        `json:"queued"`
+	NextQueued     *time.Time `json:"next_queued,omitempty"`
+}
+
+func StatusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	jsonFlag := fs.Bool("json", false, "output status as JSON")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s status [arguments]
+
+Displays who you are, and a summary of followed feeds, cached and unread
+tweets, unseen mentions and queued tweets. Nothing is fetched.
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+
+	status := Status{
+		Profile:   profile,
+		Nick:      conf.Nick,
+		Twturl:    conf.Twturl,
+		Twtfile:   conf.Twtfile,
+		Config:    conf.path,
+		Following: len(conf.Following),
+		Lists:     len(conf.Lists),
+	}
+
+	cache := LoadCache(configpath)
+	status.CachedFeeds = len(cache)
+	for _, url := range followedSources() {
+		status.Unread += len(cache[url].Unread().Filter(&conf.Filters, time.Now()))
+	}
+	seen, err := LoadSeenMentions(configpath)
+	if err != nil {
+		return fmt.Errorf("error loading seen mentions: %s", err)
+	}
+	for _, tweet := range cache.GetAll() {
+		status.CachedTweets++
+		for _, m := range tweet.Mentions() {
+			if conf.IsOwnURL(m.URL) {
+				if !seen[tweet.Hash()] && !conf.Filters.Hidden(tweet, time.Now()) {
+					status.UnseenMentions++
+				}
+				break
+			}
+		}
+	}
+
+	queue, err := LoadQueue(configpath)
+	if err != nil {
+		return fmt.Errorf("error loading queue: %s", err)
+	}
+	status.Queued = len(queue)
+	if len(queue) > 0 {
+		status.NextQueued = &queue[0].Created
+	}
+
+	if *jsonFlag {
+		PrintJSON(status)
+		return nil
+	}
+
+	who := fmt.Sprintf("%s @ %s", yellow(status.Nick), status.Twturl)
+	if status.Profile != "" {
+		who += fmt.Sprintf(" (profile %s)", status.Profile)
+	}
+	fmt.Printf("> %s\n", who)
+	fmt.Printf("twtfile:    %s\n", status.Twtfile)
+	fmt.Printf("config:     %s\n", status.Config)
+	fmt.Printf("following:  %d (in %d lists)\n", status.Following, status.Lists)
+	fmt.Printf("cached:     %d tweets from %d feeds\n", status.CachedTweets, status.CachedFeeds)
+	fmt.Printf("unread:     %d\n", status.Unread)
+	fmt.Printf("mentions:   %d unseen\n", status.UnseenMentions)
+	fmt.Printf("queued:     %d", status.Queued)
+	if status.NextQueued != nil {
+		fmt.Printf(" (next at %s)", status.NextQueued.Format(time.RFC3339))
+	}
+	fmt.Println()
+
+	return nil
+}
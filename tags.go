@@ -0,0 +1,152 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type TagCount struct {
+	Tag      string `json:"tag"`
+	Count    int    `json:"count"`
+	Previous int    `json:"previous"` // count in the window before, when counting over a duration
+}
+
+// Counts the tags (ignoring case) of tweets created within duration before
+// now, and in the equally long window before that. A zero duration counts
+// all tweets.
+func CountTags(tweets Tweets, now time.Time, duration time.Duration) []TagCount {
+	counts := make(map[string]*TagCount)
+	for _, tweet := range tweets {
+		age := now.Sub(tweet.Created)
+		previous := false
+		if duration > 0 {
+			if age > 2*duration {
+				continue
+			}
+			previous = age > duration
+		}
+		for _, tag := range tagRE.FindAllString(tweet.Text, -1) {
+			tag = strings.ToLower(tag[1:])
+			if counts[tag] == nil {
+				counts[tag] = &TagCount{Tag: tag}
+			}
+			if previous {
+				counts[tag].Previous++
+			} else {
+				counts[tag].Count++
+			}
+		}
+	}
+
+	var tags []TagCount
+	for _, tc := range counts {
+		if tc.Count > 0 {
+			tags = append(tags, *tc)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
+
+func TagsCommand(args []string) error {
+	fs := flag.NewFlagSet("tags", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	durationFlag := fs.Duration("d", 0, "only count tweets created at most `duration` back in time, comparing with the duration before that. Example: -d 168h")
+	sourceFlag := fs.String("s", "", "only count tweets by given nick")
+	listFlag := fs.String("l", "", "only count tweets by nicks in given `list`")
+	countFlag := fs.Int("c", 0, "only show the `count` most used tags")
+	dryFlag := fs.Bool("n", false, "dry-run, only locally cached tweets")
+	rawFlag := fs.Bool("r", false, "output tags in machine parsable format")
+	jsonFlag := fs.Bool("json", false, "output tags as JSON, one object per line")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s tags [arguments]
+
+Displays the tags used in the timeline, most used first. With -d, the change
+from the preceding window of the same duration is shown too.
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+	if *durationFlag < 0 {
+		return fmt.Errorf("negative duration doesn't make sense")
+	}
+	if *countFlag < 0 {
+		return fmt.Errorf("negative count doesn't make sense")
+	}
+
+	sources := followedSources()
+	switch {
+	case *sourceFlag != "" && *listFlag != "":
+		return fmt.Errorf("both nick and list makes no sense")
+	case *sourceFlag != "":
+		url, ok := sources[*sourceFlag]
+		if !ok {
+			return fmt.Errorf("no source with nick %q", *sourceFlag)
+		}
+		sources = map[string]string{*sourceFlag: url}
+	case *listFlag != "":
+		var err error
+		if sources, err = conf.ListSources(*listFlag); err != nil {
+			return err
+		}
+	}
+
+	cache := LoadCache(configpath)
+	if !*dryFlag {
+		cache.FetchTweets(sources)
+		cache.Store(configpath)
+	}
+
+	var tweets Tweets
+	refreshSources(sources)
+	for _, url := range sources {
+		tweets = append(tweets, cache.GetByURL(url)...)
+	}
+
+	now := time.Now()
+	tags := CountTags(tweets.Filter(&conf.Filters, now), now, *durationFlag)
+	if *countFlag > 0 && len(tags) > *countFlag {
+		tags = tags[:*countFlag]
+	}
+	for _, tc := range tags {
+		switch {
+		case *jsonFlag:
+			PrintJSON(tc)
+		case *rawFlag:
+			fmt.Printf("%s\t%d\t%d\n", tc.Tag, tc.Count, tc.Previous)
+		case *durationFlag > 0:
+			change := fmt.Sprintf("%+d", tc.Count-tc.Previous)
+			if tc.Count > tc.Previous {
+				change = green(change)
+			} else if tc.Count < tc.Previous {
+				change = red(change)
+			}
+			fmt.Printf("%5d %s #%s\n", tc.Count, change, blue(tc.Tag))
+		default:
+			fmt.Printf("%5d #%s\n", tc.Count, blue(tc.Tag))
+		}
+	}
+
+	return nil
+}
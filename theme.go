@@ -0,0 +1,125 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Styles for the parts of a tweet (roles), by the theme in config. A style is
+// a space separated list of colours (black, red, green, yellow, blue, magenta,
+// cyan, white, and bright- variants of them), attributes (bold, dim, italic,
+// underline, reverse, strike), or raw SGR codes. Empty means plain. Roles not in the
+// config get their style from here.
+var defaultTheme = map[string]string{
+	"nick":      "green",
+	"ownnick":   "bold green",
+	"mentionme": "red",
+	"mention":   "blue",
+	"timestamp": "",
+	"hash":      "",
+	"new":       "yellow",
+	"highlight": "reverse",
+	"link":      "underline",
+	"code":      "cyan",
+}
+
+// Returns the style of role, and whether it is a role at all.
+func themeStyle(role string) (string, bool) {
+	style, ok := defaultTheme[role]
+	if !ok {
+		return "", false
+	}
+	if s, ok := conf.Theme[role]; ok {
+		style = s
+	}
+	return style, true
+}
+
+var sgrCodes = map[string]int{
+	"bold": 1, "dim": 2, "italic": 3, "underline": 4, "reverse": 7, "strike": 9,
+	"black": 30, "red": 31, "green": 32, "yellow": 33,
+	"blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+}
+
+// Turns a style like "bold red" into SGR parameters like "1;31".
+func parseStyle(style string) (string, error) {
+	var codes []string
+	for _, word := range strings.Fields(strings.ToLower(style)) {
+		if _, err := strconv.Atoi(strings.Replace(word, ";", "", -1)); err == nil {
+			codes = append(codes, word)
+			continue
+		}
+		bright := strings.HasPrefix(word, "bright-")
+		code, ok := sgrCodes[strings.TrimPrefix(word, "bright-")]
+		if !ok || (bright && code < 30) {
+			return "", fmt.Errorf("unknown style %q", word)
+		}
+		if bright {
+			code += 60
+		}
+		codes = append(codes, strconv.Itoa(code))
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+// Whether to output colour escapes at all.
+var colorEnabled = true
+
+// Decides on colorEnabled, by mode auto (colour only to a terminal, and not
+// if NO_COLOR is set), always or never.
+func SetColorMode(mode string) error {
+	switch strings.ToLower(mode) {
+	case "", "auto":
+		colorEnabled = os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	case "always":
+		colorEnabled = true
+	case "never":
+		colorEnabled = false
+	default:
+		return fmt.Errorf("unexpected color mode %q, want auto, always or never", mode)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Applies the SGR parameters to s, if colour is enabled.
+func sgr(params, s string) string {
+	if !colorEnabled || params == "" {
+		return s
+	}
+	return fmt.Sprintf("\033[%sm%s\033[0m", params, s)
+}
+
+// Styles s according to the theme's role (like "mentionme"), or a style
+// given as such (like "bold red").
+func styled(roleOrStyle, s string) (string, error) {
+	style, ok := themeStyle(roleOrStyle)
+	if !ok {
+		style = roleOrStyle
+	}
+	params, err := parseStyle(style)
+	if err != nil {
+		return "", err
+	}
+	return sgr(params, s), nil
+}
+
+// Like styled, for roles (which parse, as checked by Config.Read).
+func themed(role, s string) string {
+	out, err := styled(role, s)
+	if err != nil {
+		return s
+	}
+	return out
+}
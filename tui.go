@@ -0,0 +1,597 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	paneTimeline = iota
+	paneMentions
+	paneFeed
+)
+
+var paneNames = []string{"timeline", "mentions", "feed"}
+
+const tuiHelp = "j/k move  space/b page  g/G first/last  1 timeline  2 mentions  " +
+	"f feed  tab next pane  r reply  c compose  m mute  o open link  u update  q quit"
+
+// The state of the full-screen client.
+type tui struct {
+	cache      Cache
+	dry        bool
+	pane       int
+	feed       Tweeter // whose tweets the feed pane shows
+	tweets     Tweets  // of the pane, newest first
+	selected   int
+	top        int   // line shown first
+	starts     []int // the line each tweet starts at, as last drawn
+	cols, rows int
+	flagWidth  int    // -width, as given
+	message    string // shown in the status line, until the next key
+	pending    func(key string)
+	fetching   bool
+	fetched    chan tuiFetched
+	fd         int
+	state      *terminal.State
+}
+
+func TUICommand(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	dryFlag := fs.Bool("n", false, "dry-run, only locally cached tweets")
+	intervalFlag := fs.Duration("i", 5*time.Minute, "update the feeds every `interval`; 0 for only when asked to")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s tui [arguments]
+
+Runs a full-screen client, showing the timeline, the tweets mentioning you,
+or those of a single feed, newest first. Feeds are updated at start and then
+every interval.
+
+Keys: %s
+
+`, progname, tuiHelp)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+	if *intervalFlag < 0 {
+		return fmt.Errorf("negative interval doesn't make sense")
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(termOut) {
+		return fmt.Errorf("tui needs a terminal")
+	}
+
+	t := &tui{
+		cache:     LoadCache(configpath),
+		dry:       *dryFlag,
+		flagWidth: width,
+		fetched:   make(chan tuiFetched),
+		fd:        int(os.Stdin.Fd()),
+	}
+	quiet = true
+	if err := t.enter(); err != nil {
+		return err
+	}
+	defer t.leave()
+	defer t.wait()
+
+	// Reading a key only when asked to, so that nothing is read from under
+	// the editor
+	keys := make(chan string)
+	next := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 64)
+		for range next {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	var tick <-chan time.Time
+	if *intervalFlag > 0 && !t.dry {
+		ticker := time.NewTicker(*intervalFlag)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	t.resize()
+	t.load()
+	t.refresh()
+	t.draw()
+	next <- true
+	for {
+		select {
+		case chunk, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, key := range splitKeys(chunk) {
+				if t.handle(key) {
+					return nil
+				}
+			}
+			next <- true
+		case fetched := <-t.fetched:
+			cache := fetched.cache
+			fetched.fetch.finish(cache)
+			if n := len(cache.GetAll()) - len(t.cache.GetAll()); n > 0 {
+				t.message = fmt.Sprintf("%d new tweets", n)
+			}
+			t.fetching = false
+			t.cache = cache
+			t.load()
+		case <-tick:
+			t.refresh()
+		case <-winch:
+			t.resize()
+		}
+		t.draw()
+	}
+}
+
+// Takes over the screen.
+func (t *tui) enter() error {
+	state, err := terminal.MakeRaw(t.fd)
+	if err != nil {
+		return fmt.Errorf("error setting up terminal: %s", err)
+	}
+	t.state = state
+	// Alternate screen, no cursor, no line wrapping
+	fmt.Print("\033[?1049h\033[?25l\033[?7l")
+	return nil
+}
+
+// Gives the screen back.
+func (t *tui) leave() {
+	fmt.Print("\033[?7h\033[?25h\033[?1049l")
+	if t.state != nil {
+		_ = terminal.Restore(t.fd, t.state)
+		t.state = nil
+	}
+}
+
+func (t *tui) resize() {
+	cols, rows, err := terminal.GetSize(int(termOut.Fd()))
+	if err != nil || cols == 0 || rows < 3 {
+		cols, rows = 80, 24
+	}
+	t.cols, t.rows = cols, rows
+	// Wrapping to leave room for the selection mark
+	width = t.flagWidth
+	if w := outputWidth(); w == 0 || w > cols-2 {
+		width = cols - 2
+	}
+}
+
+// The cache updated in the background, with the fetch to finish.
+type tuiFetched struct {
+	cache Cache
+	fetch *feedsFetch
+}
+
+// Updates the feeds in the background, sending the updated cache to
+// t.fetched. Feeds that moved are followed when that arrives, not to touch
+// conf while the main loop reads it.
+func (t *tui) refresh() {
+	if t.dry || t.fetching {
+		return
+	}
+	t.fetching = true
+	cache := make(Cache, len(t.cache))
+	for url, cached := range t.cache {
+		cache[url] = cached
+	}
+	sources := followedSources()
+	go func() {
+		fetch := cache.fetchFeeds(sources)
+		cache.Store(configpath)
+		t.fetched <- tuiFetched{cache, fetch}
+	}()
+}
+
+// Waits for an update running in the background to be done, so that the
+// cache is not left half written.
+func (t *tui) wait() {
+	if !t.fetching {
+		return
+	}
+	t.message = "finishing the update of the feeds..."
+	t.draw()
+	fetched := <-t.fetched
+	fetched.fetch.finish(fetched.cache)
+	t.fetching = false
+}
+
+// Collects the tweets of the pane, keeping the selected one selected.
+func (t *tui) load() {
+	var selected string
+	if t.selected < len(t.tweets) {
+		selected = t.tweets[t.selected].Hash()
+	}
+	var tweets Tweets
+	switch t.pane {
+	case paneTimeline:
+		for _, url := range followedSources() {
+			tweets = append(tweets, t.cache.GetByURL(url)...)
+		}
+	case paneMentions:
+		tweets = Mentioning(t.cache.GetAll())
+	case paneFeed:
+		tweets = t.cache.GetByURL(t.feed.URL)
+	}
+	tweets = tweets.Filter(&conf.Filters, time.Now())
+	sort.Sort(sort.Reverse(tweets))
+
+	t.tweets = tweets
+	t.selected = 0
+	for i, tweet := range tweets {
+		if tweet.Hash() == selected {
+			t.selected = i
+			break
+		}
+	}
+}
+
+func (t *tui) show(pane int) {
+	if pane == paneFeed && t.feed.URL == "" {
+		pane = paneTimeline
+	}
+	if pane != t.pane {
+		t.pane, t.selected, t.top = pane, 0, 0
+		t.tweets = nil
+		t.load()
+	}
+}
+
+func (t *tui) title() string {
+	if t.pane == paneFeed {
+		return fmt.Sprintf("%s %s", paneNames[t.pane], t.feed.Nick)
+	}
+	return paneNames[t.pane]
+}
+
+func (t *tui) draw() {
+	now := time.Now()
+	var lines []string
+	t.starts = t.starts[:0]
+	for i, tweet := range t.tweets {
+		out, err := FormatTweet(tweet, now, PrintOptions{})
+		if err != nil {
+			t.message = err.Error()
+			break
+		}
+		mark := "  "
+		if i == t.selected {
+			mark = "▌ "
+		}
+		t.starts = append(t.starts, len(lines))
+		for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+			lines = append(lines, mark+line)
+		}
+		lines = append(lines, "")
+	}
+
+	// Scrolling the selected tweet into view
+	height := t.rows - 2
+	if t.selected < len(t.starts) {
+		first := t.starts[t.selected]
+		last := len(lines) - 2
+		if t.selected+1 < len(t.starts) {
+			last = t.starts[t.selected+1] - 2
+		}
+		if last >= t.top+height {
+			t.top = last - height + 1
+		}
+		if first < t.top {
+			t.top = first
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	header := fmt.Sprintf(" %s: %s (%d)", progname, t.title(), len(t.tweets))
+	if t.fetching {
+		header += ", updating…"
+	}
+	b.WriteString(sgr("7", padRight(header, t.cols)) + "\r\n")
+	for row := 0; row < height; row++ {
+		if i := t.top + row; i < len(lines) {
+			b.WriteString(lines[i])
+		}
+		b.WriteString("\033[K\r\n")
+	}
+	status := t.message
+	if status == "" {
+		status = "? for help, q to quit"
+	}
+	b.WriteString(" " + status + "\033[K")
+	fmt.Print(b.String())
+}
+
+func padRight(s string, cols int) string {
+	if w := displayWidth(s); w < cols {
+		return s + strings.Repeat(" ", cols-w)
+	}
+	return s
+}
+
+// Handles a key, returning whether to quit.
+func (t *tui) handle(key string) bool {
+	if t.pending != nil {
+		pending := t.pending
+		t.pending = nil
+		t.message = ""
+		pending(key)
+		return false
+	}
+	t.message = ""
+	switch key {
+	case "q", "\x03":
+		return true
+	case "j", keyDown:
+		t.move(1)
+	case "k", keyUp:
+		t.move(-1)
+	case " ", keyPageDown, "\x06":
+		t.page(1)
+	case "b", keyPageUp, "\x02":
+		t.page(-1)
+	case "g", keyHome:
+		t.selected = 0
+	case "G", keyEnd:
+		t.move(len(t.tweets))
+	case "1":
+		t.show(paneTimeline)
+	case "2":
+		t.show(paneMentions)
+	case "\t":
+		t.show((t.pane + 1) % len(paneNames))
+	case "f", "\r":
+		if tweet, ok := t.current(); ok {
+			t.feed = tweet.Tweeter
+			t.pane, t.selected, t.top = paneFeed, 0, 0
+			t.tweets = nil
+			t.load()
+		}
+	case "u":
+		if t.dry {
+			t.message = "not updating in dry-run"
+		}
+		t.refresh()
+	case "c":
+		t.compose("")
+	case "r":
+		if tweet, ok := t.current(); ok {
+			t.compose(replyTemplate(tweet) + " ")
+		}
+	case "m":
+		if tweet, ok := t.current(); ok {
+			t.mute(tweet.Tweeter.Nick)
+		}
+	case "o":
+		if tweet, ok := t.current(); ok {
+			t.open(tweet)
+		}
+	case "?":
+		t.message = tuiHelp
+	}
+	return false
+}
+
+const (
+	keyUp       = "\033[A"
+	keyDown     = "\033[B"
+	keyPageUp   = "\033[5~"
+	keyPageDown = "\033[6~"
+	keyHome     = "\033[H"
+	keyEnd      = "\033[F"
+)
+
+// Splits what was read from the terminal into keys, an escape sequence
+// being one.
+func splitKeys(s string) []string {
+	var keys []string
+	for s != "" {
+		n := 1
+		if strings.HasPrefix(s, "\033[") || strings.HasPrefix(s, "\033O") {
+			// Up to and including the final byte
+			n = 2
+			for n < len(s) && (s[n] < 0x40 || s[n] > 0x7e) {
+				n++
+			}
+			if n < len(s) {
+				n++
+			}
+		} else {
+			_, n = utf8.DecodeRuneInString(s)
+		}
+		key := s[:n]
+		switch key {
+		case "\033OA", "\033OB", "\033OH", "\033OF":
+			key = "\033[" + key[2:]
+		case "\033[1~", "\033[7~":
+			key = keyHome
+		case "\033[4~", "\033[8~":
+			key = keyEnd
+		}
+		keys = append(keys, key)
+		s = s[n:]
+	}
+	return keys
+}
+
+func (t *tui) current() (Tweet, bool) {
+	if t.selected >= len(t.tweets) {
+		return Tweet{}, false
+	}
+	return t.tweets[t.selected], true
+}
+
+func (t *tui) move(n int) {
+	t.selected += n
+	if t.selected >= len(t.tweets) {
+		t.selected = len(t.tweets) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+}
+
+// Moves a screenful, selecting the first tweet starting on it.
+func (t *tui) page(dir int) {
+	target := t.top + dir*(t.rows-2)
+	if target < 0 {
+		target = 0
+	}
+	for i, start := range t.starts {
+		if start >= target {
+			t.top = target
+			t.selected = i
+			return
+		}
+	}
+	t.move(len(t.tweets))
+}
+
+// The start of a reply to tweet: the twtxt reply subject, "(#<hash>)", and a
+// mention of its author.
+func replyTemplate(tweet Tweet) string {
+	subject := "(#" + tweet.Hash() + ") "
+	if conf.Following[tweet.Tweeter.Nick] == tweet.Tweeter.URL {
+		return subject + "@" + tweet.Tweeter.Nick
+	}
+	return subject + fmt.Sprintf("@<%s %s>", tweet.Tweeter.Nick, tweet.Tweeter.URL)
+}
+
+// Lets the user write a tweet in $EDITOR, and tweets it.
+func (t *tui) compose(template string) {
+	t.leave()
+	err := func() error {
+		text, err := editText(template)
+		if err != nil {
+			return fmt.Errorf("editor: %v", err)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || text == strings.TrimSpace(template) {
+			return errAborted
+		}
+		twtfile, err := conf.TwtfilePath()
+		if err != nil {
+			return err
+		}
+		return PostTweets(twtfile, Tweets{{
+			Tweeter: Tweeter{Nick: conf.Nick, URL: conf.Twturl},
+			Created: time.Now(),
+			Text:    EncodeMultiline(ExpandMentions(text)),
+		}})
+	}()
+	if eerr := t.enter(); eerr != nil {
+		t.message = eerr.Error()
+		return
+	}
+	if err != nil {
+		t.message = err.Error()
+		return
+	}
+	t.message = "tweeted"
+	t.refresh()
+}
+
+func (t *tui) mute(nick string) {
+	t.message = fmt.Sprintf("mute %s? (y/n)", nick)
+	t.pending = func(key string) {
+		if key != "y" {
+			return
+		}
+		if conf.Filters.Mute == nil {
+			conf.Filters.Mute = make(map[string]string)
+		}
+		conf.Filters.Mute[nick] = ""
+		if err := conf.Write(); err != nil {
+			t.message = fmt.Sprintf("error writing config: %s", err)
+			return
+		}
+		t.message = fmt.Sprintf("muted %s; undo with: %s mute -undo %s", nick, progname, nick)
+		t.load()
+	}
+}
+
+// URLs, except those of mentions.
+var linkRE = regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^\s<>()]+`)
+
+// Opens a link of the tweet, asking which if there are several.
+func (t *tui) open(tweet Tweet) {
+	var links []string
+	for _, link := range linkRE.FindAllString(mentionRE.ReplaceAllString(tweet.Text, ""), -1) {
+		links = append(links, strings.TrimRight(link, ".,:;!?"))
+	}
+	switch len(links) {
+	case 0:
+		t.message = "no links"
+		return
+	case 1:
+		t.openURL(links[0])
+		return
+	}
+	if len(links) > 9 {
+		links = links[:9]
+	}
+	var choices []string
+	for i, link := range links {
+		choices = append(choices, fmt.Sprintf("%d %s", i+1, CompactURL(link)))
+	}
+	t.message = "open which? " + strings.Join(choices, "  ")
+	t.pending = func(key string) {
+		if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(links) {
+			t.openURL(links[n-1])
+		}
+	}
+}
+
+// Opens url with $BROWSER, or the desktop's opener.
+func (t *tui) openURL(url string) {
+	opener := os.Getenv("BROWSER")
+	if opener == "" {
+		opener = "xdg-open"
+		if runtime.GOOS == "darwin" {
+			opener = "open"
+		}
+	}
+	cmd := exec.Command("/bin/sh", "-c", opener+` "$1"`, "sh", url)
+	if err := cmd.Start(); err != nil {
+		t.message = fmt.Sprintf("error opening link: %s", err)
+		return
+	}
+	go func() { _ = cmd.Wait() }()
+	t.message = "opened " + CompactURL(url)
+}
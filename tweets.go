@@ -4,15 +4,24 @@ package main
 
 import (
 	"bufio"
+	"encoding/base32"
+	"fmt"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/crypto/blake2b"
 )
 
+// Twts spanning multiple lines are stored on a single line in the twtfile,
+// with the lines separated by the Unicode LINE SEPARATOR.
+const LineSeparator = "\u2028"
+
 type Tweeter struct {
-	Nick string
-	URL  string
+	Nick string `json:"nick,omitempty"`
+	URL  string `json:"url"`
 }
 type Tweet struct {
 	Tweeter Tweeter
@@ -33,11 +42,52 @@ func (tweets Tweets) Swap(i, j int) {
 	tweets[i], tweets[j] = tweets[j], tweets[i]
 }
 
+// Returns the twt hash, as used by twtxt.net and other clients for threading:
+// the last 7 characters of the base32 encoded blake2b-256 sum of feed URL,
+// timestamp (RFC3339, UTC), and text, each separated by newline.
+func (tweet Tweet) Hash() string {
+	payload := fmt.Sprintf("%s\n%s\n%s", tweet.Tweeter.URL,
+		tweet.Created.UTC().Format(time.RFC3339), tweet.Text)
+	sum := blake2b.Sum256([]byte(payload))
+	hash := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:]))
+	return hash[len(hash)-7:]
+}
+
+// Turns a hash (or start of one) as given by the user, like "#ABC", into the
+// form Hash returns.
+func NormalizeHash(hash string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(hash)), "#")
+}
+
+var mentionRE = regexp.MustCompile(`@<(?:([^ >]+) +)?([^ >]+)>`)
+
+// Returns the mentions ("@<nick URL>" or "@<URL>") in the tweet text.
+func (tweet Tweet) Mentions() []Tweeter {
+	var mentions []Tweeter
+	for _, parts := range mentionRE.FindAllStringSubmatch(tweet.Text, -1) {
+		mentions = append(mentions, Tweeter{Nick: parts[1], URL: parts[2]})
+	}
+	return mentions
+}
+
+var tagRE = regexp.MustCompile(`#[-\w]+`)
+
+// Tells whether the tweet is tagged with tag (with or without leading #),
+// ignoring case.
+func (tweet Tweet) HasTag(tag string) bool {
+	tag = strings.TrimPrefix(tag, "#")
+	for _, t := range tagRE.FindAllString(tweet.Text, -1) {
+		if strings.EqualFold(t[1:], tag) {
+			return true
+		}
+	}
+	return false
+}
+
 func (tweets Tweets) Tags() map[string]int {
 	tags := make(map[string]int)
-	re := regexp.MustCompile(`#[-\w]+`)
 	for _, tweet := range tweets {
-		for _, tag := range re.FindAllString(tweet.Text, -1) {
+		for _, tag := range tagRE.FindAllString(tweet.Text, -1) {
 			tags[strings.TrimLeft(tag, "#")]++
 		}
 	}
@@ -46,30 +96,12 @@ func (tweets Tweets) Tags() map[string]int {
 
 func ParseFile(scanner *bufio.Scanner, tweeter Tweeter) Tweets {
 	var tweets Tweets
-	re := regexp.MustCompile(`^(.+?)(\s+)(.+)$`) // .+? is ungreedy
+	// Multi-line twts can get long, allow lines past the default 64K.
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := re.FindStringSubmatch(line)
-		// "Submatch 0 is the match of the entire expression, submatch 1 the
-		// match of the first parenthesized subexpression, and so on."
-		if len(parts) != 4 {
-			if debug {
-				log.Printf("could not parse: '%s' (source:%s)\n", line, tweeter.URL)
-			}
-			continue
+		if tweet, ok := ParseLine(scanner.Text(), tweeter); ok {
+			tweets = append(tweets, tweet)
 		}
-		tweets = append(tweets,
-			Tweet{
-				Tweeter: tweeter,
-				Created: ParseTime(parts[1]),
-				Text:    parts[3],
-			})
 	}
 	if err := scanner.Err(); err != nil {
 		panic(err)
@@ -77,6 +109,33 @@ func ParseFile(scanner *bufio.Scanner, tweeter Tweeter) Tweets {
 	return tweets
 }
 
+var lineRE = regexp.MustCompile(`^(.+?)(\s+)(.+)$`) // .+? is ungreedy
+
+// Parses one line of a twtfile. Returns false for empty lines, comments, and
+// lines that could not be parsed.
+func ParseLine(line string, tweeter Tweeter) (Tweet, bool) {
+	if line == "" {
+		return Tweet{}, false
+	}
+	if strings.HasPrefix(line, "#") {
+		return Tweet{}, false
+	}
+	parts := lineRE.FindStringSubmatch(line)
+	// "Submatch 0 is the match of the entire expression, submatch 1 the
+	// match of the first parenthesized subexpression, and so on."
+	if len(parts) != 4 {
+		if debug {
+			log.Printf("could not parse: '%s' (source:%s)\n", line, tweeter.URL)
+		}
+		return Tweet{}, false
+	}
+	return Tweet{
+		Tweeter: tweeter,
+		Created: ParseTime(parts[1]),
+		Text:    strings.Trim(parts[3], LineSeparator),
+	}, true
+}
+
 func ParseTime(timestr string) time.Time {
 	var tm time.Time
 	var err error
@@ -102,3 +161,72 @@ func ParseTime(timestr string) time.Time {
 	}
 	return tm
 }
+
+// Turns newlines into LineSeparator, so that the text can be written as a
+// single line in the twtfile.
+func EncodeMultiline(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.Replace(text, "\n", LineSeparator, -1)
+}
+
+// Turns LineSeparator back into newlines.
+func DecodeMultiline(text string) string {
+	return strings.Replace(text, LineSeparator, "\n", -1)
+}
+
+// Parses a point in time given by the user, relative to now. Accepts a
+// duration ("2h30m", also with days "3d" or weeks "2w"), a time of day
+// ("15:04"), a date ("2006-01-02"), a date with time ("2006-01-02 15:04" or
+// "2006-01-02T15:04"), or RFC3339. Durations and times of day are taken into
+// the past if past is set, otherwise into the future. Times without zone are
+// taken as local.
+func ParseUserTime(s string, now time.Time, past bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, err := parseDuration(strings.TrimPrefix(s, "+")); err == nil {
+		if past {
+			return now.Add(-d), nil
+		}
+		return now.Add(d), nil
+	}
+	if tm, err := time.Parse(time.RFC3339, s); err == nil {
+		return tm, nil
+	}
+	if tm, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		tm = time.Date(now.Year(), now.Month(), now.Day(),
+			tm.Hour(), tm.Minute(), 0, 0, now.Location())
+		if past && tm.After(now) {
+			tm = tm.AddDate(0, 0, -1)
+		} else if !past && tm.Before(now) {
+			tm = tm.AddDate(0, 0, 1)
+		}
+		return tm, nil
+	}
+	for _, layout := range []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if tm, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse time: %q", s)
+}
+
+// Like time.ParseDuration, but also accepts a whole number of days ("3d") or
+// weeks ("2w").
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	} {
+		if strings.HasSuffix(s, suffix) {
+			if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	return time.ParseDuration(s)
+}
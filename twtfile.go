@@ -0,0 +1,214 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Our twtfile, read line by line so it can be written back unchanged except
+// for the lines we touch.
+type twtfileLines struct {
+	path  string
+	lines []string
+}
+
+func readTwtfile() (*twtfileLines, error) {
+	if conf.Twturl == "" {
+		return nil, fmt.Errorf("cannot identify tweets without twturl set in config")
+	}
+	twtfile, err := conf.TwtfilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(twtfile)
+	if err != nil {
+		return nil, err
+	}
+	return &twtfileLines{
+		path:  twtfile,
+		lines: strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"),
+	}, nil
+}
+
+// Returns the index of the line holding the tweet whose hash starts with
+// hash.
+func (tf *twtfileLines) find(hash string) (int, Tweet, error) {
+	hash = NormalizeHash(hash)
+	if hash == "" {
+		return -1, Tweet{}, fmt.Errorf("empty hash")
+	}
+	found := -1
+	var tweet Tweet
+	for i, line := range tf.lines {
+		t, ok := ParseLine(line, Tweeter{Nick: conf.Nick, URL: conf.Twturl})
+		if !ok || !strings.HasPrefix(t.Hash(), hash) {
+			continue
+		}
+		if found != -1 {
+			return -1, Tweet{}, fmt.Errorf("hash %q is ambiguous", hash)
+		}
+		found, tweet = i, t
+	}
+	if found == -1 {
+		return -1, Tweet{}, fmt.Errorf("no tweet with hash %q in %s", hash, conf.Twtfile)
+	}
+	return found, tweet, nil
+}
+
+func (tf *twtfileLines) write() error {
+	var data string
+	for _, line := range tf.lines {
+		data += line + "\n"
+	}
+	return writeFileAtomic(tf.path, []byte(data), true)
+}
+
+func DeleteCommand(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s delete <hash>...
+
+Deletes your own tweets with the given hashes (or unique prefixes of them)
+from your twtfile. The previous twtfile is kept with a .bak suffix. The pre
+hook is run for each tweet, with its text in $TWET_TEXT and hash in
+$TWET_HASH; failing, it keeps the tweet. The post hook is run once afterwards,
+as after tweeting.
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("too few arguments given")
+	}
+
+	tf, err := readTwtfile()
+	if err != nil {
+		return err
+	}
+	var tweets Tweets
+	for _, hash := range fs.Args() {
+		_, tweet, err := tf.find(hash)
+		if err != nil {
+			return err
+		}
+		tweets = append(tweets, tweet)
+	}
+	approved, veto := vetTweets("pre-delete", tweets)
+	if len(approved) == 0 {
+		return veto
+	}
+
+	// Reading again, in case the hook updated the twtfile
+	if tf, err = readTwtfile(); err != nil {
+		return err
+	}
+	remove := make(map[int]bool)
+	var deleted Tweets
+	for _, tweet := range approved {
+		i, tweet, err := tf.find(tweet.Hash())
+		if err != nil {
+			return err
+		}
+		remove[i] = true
+		deleted = append(deleted, tweet)
+	}
+	var kept []string
+	for i, line := range tf.lines {
+		if remove[i] {
+			fmt.Printf("deleted from %s:\n%s\n", conf.Twtfile, line)
+			continue
+		}
+		kept = append(kept, line)
+	}
+	tf.lines = kept
+	if err := tf.write(); err != nil {
+		return fmt.Errorf("error writing twtfile: %s", err)
+	}
+
+	if err := postHook("post-delete", deleted); err != nil {
+		return err
+	}
+	return veto
+}
+
+func EditCommand(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s edit <hash>
+
+Edits the text of your own tweet with the given hash (or a unique prefix of
+it) in $EDITOR, keeping its timestamp. Note that the tweet gets a new hash.
+The previous twtfile is kept with a .bak suffix. The tweet hooks are run
+around the change, with the tweet (as it was, for the pre hook) in $TWET_TEXT
+and $TWET_HASH.
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("too few arguments given")
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments given")
+	}
+
+	tf, err := readTwtfile()
+	if err != nil {
+		return err
+	}
+	_, tweet, err := tf.find(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := runHook("pre-edit", conf.Hooks.Pre, tweetEnv(tweet)); err != nil {
+		return err
+	}
+
+	// Reading again, in case the hook updated the twtfile
+	if tf, err = readTwtfile(); err != nil {
+		return err
+	}
+	i, tweet, err := tf.find(tweet.Hash())
+	if err != nil {
+		return err
+	}
+
+	text, err := editText(DecodeMultiline(tweet.Text))
+	if err != nil {
+		return fmt.Errorf("editor: %v", err)
+	}
+	text = EncodeMultiline(ExpandMentions(strings.TrimSpace(text)))
+	if text == "" || text == tweet.Text {
+		return errAborted
+	}
+
+	// Keeping the timestamp exactly as it was written
+	parts := lineRE.FindStringSubmatch(tf.lines[i])
+	tf.lines[i] = parts[1] + parts[2] + text
+	if err := tf.write(); err != nil {
+		return fmt.Errorf("error writing twtfile: %s", err)
+	}
+	tweet.Text = text
+	fmt.Printf("edited in %s (new hash %s):\n%s\n", conf.Twtfile, tweet.Hash(), tf.lines[i])
+
+	return postHook("post-edit", Tweets{tweet})
+}
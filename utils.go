@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 )
 
@@ -29,12 +33,22 @@ func (res *execResult) Read(p []byte) (n int, err error) {
 }
 
 func execShell(dir, cmd string) (res *execResult, err error) {
+	return execShellWith(dir, cmd, nil, nil)
+}
+
+// Like execShell, adding env to the environment, and giving stdin (if not
+// nil) as input.
+func execShellWith(dir, cmd string, env []string, stdin io.Reader) (res *execResult, err error) {
 	res = &execResult{}
 
 	sh := exec.Command("/bin/sh", "-c", cmd)
 	if dir != "" {
 		sh.Dir = dir
 	}
+	if env != nil {
+		sh.Env = append(os.Environ(), env...)
+	}
+	sh.Stdin = stdin
 
 	res.Output, err = sh.CombinedOutput()
 	if err != nil {
@@ -55,3 +69,46 @@ func execShell(dir, cmd string) (res *execResult, err error) {
 
 	return
 }
+
+// Replaces the file at path with data, by writing to a temporary file in the
+// same directory and renaming it over the original. If backup is set, the
+// original is kept with a ".bak" suffix.
+func writeFileAtomic(path string, data []byte, backup bool) error {
+	mode := os.FileMode(0666)
+	if stat, err := os.Stat(path); err == nil {
+		mode = stat.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+
+	if backup {
+		orig, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = ioutil.WriteFile(path+".bak", orig, mode)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error keeping backup: %s", err)
+		}
+	}
+
+	return os.Rename(f.Name(), path)
+}
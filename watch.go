@@ -0,0 +1,147 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// When to fetch a feed next, backing off while it has nothing new.
+type watched struct {
+	next    time.Time
+	backoff time.Duration
+}
+
+// Schedules the next fetch of a feed, after interval if it had news, or
+// else after twice as long as the last time, up to max.
+func (w *watched) schedule(now time.Time, news bool, interval, max time.Duration) {
+	switch {
+	case news || w.backoff == 0:
+		w.backoff = interval
+	default:
+		w.backoff *= 2
+		if w.backoff > max {
+			w.backoff = max
+		}
+	}
+	w.next = now.Add(w.backoff)
+}
+
+func WatchCommand(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	intervalFlag := fs.Duration("i", 5*time.Minute, "fetch feeds every `interval`, while they have new tweets")
+	maxFlag := fs.Duration("max", time.Hour, "fetch quiet feeds at least every `interval`")
+	rawFlag := fs.Bool("r", false, "output tweets in URL-prefixed twtxt format")
+	jsonFlag := fs.Bool("json", false, "output tweets as JSON, one object per line")
+	formatFlag := fs.String("format", "", "print tweets in `format`, named in config or a template")
+
+	fs.Usage = func() {
+		fmt.Printf(`usage: %s watch [arguments]
+
+Keeps fetching the followed feeds, printing tweets as they arrive, until
+interrupted. Feeds with no new tweets are fetched less and less often, down to
+every max interval, and again every interval once they have.
+
+`, progname)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return fmt.Errorf("error parsing arguments")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments given")
+	}
+	if *intervalFlag <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if *maxFlag < *intervalFlag {
+		*maxFlag = *intervalFlag
+	}
+	if *formatFlag != "" {
+		if err := SetFormat(*formatFlag); err != nil {
+			return err
+		}
+	}
+	quiet = true
+
+	// Whatever is cached already counts as seen
+	cache := LoadCache(configpath)
+	seen := make(map[string]bool)
+	for _, tweet := range cache.GetAll() {
+		seen[tweet.Hash()] = true
+	}
+
+	feeds := make(map[string]*watched)
+	for {
+		now := time.Now()
+		sources := followedSources()
+		due := make(map[string]string)
+		for nick, url := range sources {
+			if feeds[url] == nil {
+				feeds[url] = &watched{}
+			}
+			if !feeds[url].next.After(now) {
+				due[nick] = url
+			}
+		}
+
+		if len(due) > 0 {
+			cache.FetchTweets(due)
+			cache.Store(configpath)
+			refreshSources(due)
+
+			now = time.Now()
+			var arrived Tweets
+			for _, url := range due {
+				news := false
+				for _, tweet := range cache.GetByURL(url) {
+					if hash := tweet.Hash(); !seen[hash] {
+						seen[hash] = true
+						arrived = append(arrived, tweet)
+						news = true
+					}
+				}
+				if feeds[url] == nil {
+					// The feed moved
+					feeds[url] = &watched{}
+				}
+				feeds[url].schedule(now, news, *intervalFlag, *maxFlag)
+				if debug {
+					log.Printf("%s: next in %s", url, feeds[url].backoff)
+				}
+			}
+
+			arrived = arrived.Filter(&conf.Filters, now)
+			sort.Sort(arrived)
+			for _, tweet := range arrived {
+				switch {
+				case *jsonFlag:
+					PrintTweetJSON(tweet, PrintOptions{New: true})
+				case *rawFlag:
+					PrintTweetRaw(tweet)
+					fmt.Println()
+				default:
+					PrintTweet(tweet, now)
+				}
+			}
+		}
+
+		// Sleeping until the next feed is due
+		next := now.Add(*maxFlag)
+		for _, url := range sources {
+			if w := feeds[url]; w != nil && w.next.Before(next) {
+				next = w.next
+			}
+		}
+		time.Sleep(time.Until(next))
+	}
+}
@@ -0,0 +1,128 @@
+// -*- tab-width: 4; -*-
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// The columns to wrap tweet text at, as set by -width on the command line.
+// Zero leaves it to the config.
+var width int
+
+// Returns the columns to wrap tweet text at, or 0 for not wrapping. The
+// width configured (or given by -width) is used if positive; if negative,
+// nothing is wrapped; if zero, the text is wrapped to the terminal, when
+// output goes to one.
+func outputWidth() int {
+	w := conf.Width
+	if width != 0 {
+		w = width
+	}
+	if w != 0 {
+		if w < 0 {
+			return 0
+		}
+		return w
+	}
+	if !isTerminal(termOut) {
+		return 0
+	}
+	w, _, err := terminal.GetSize(int(termOut.Fd()))
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+// Columns s takes up in a terminal, counting wide characters (like CJK) as
+// two, and colour escapes as none.
+func displayWidth(s string) int {
+	return runewidth.StringWidth(ansiRE.ReplaceAllString(s, ""))
+}
+
+// Words to wrap at, with a mention like @<nick url> being one.
+var wrapWordRE = regexp.MustCompile(`@<[^>]*>\S*|\S+`)
+
+// Whether a word too long for a line may be broken. URLs, mentions, and
+// words with colour escapes never are.
+func breakable(word string) bool {
+	return !strings.Contains(word, "://") && !strings.HasPrefix(word, "@") &&
+		!ansiRE.MatchString(word)
+}
+
+// Wraps each line of text at width columns, at whitespace, starting the
+// lines continuing it with hang (hanging indentation). Words longer than a
+// line are broken, unless they are URLs or mentions, which rather are left
+// overlong. A width of 0 or less leaves text as it is.
+func Wrap(text string, width int, hang string) string {
+	if width <= 0 {
+		return text
+	}
+	if displayWidth(hang) >= width {
+		hang = ""
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = wrapLine(line, width, hang)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapLine(line string, width int, hang string) string {
+	if displayWidth(line) <= width {
+		return line
+	}
+	hangWidth := displayWidth(hang)
+
+	// Keeping any indentation of the line itself
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	var b strings.Builder
+	b.WriteString(indent)
+	col := displayWidth(indent)
+	fresh := true // nothing but indentation on the line yet
+
+	for _, word := range wrapWordRE.FindAllString(line, -1) {
+		w := displayWidth(word)
+		if !fresh {
+			if col+1+w > width {
+				b.WriteString("\n" + hang)
+				col = hangWidth
+			} else {
+				b.WriteByte(' ')
+				col++
+			}
+		}
+		for col+w > width && breakable(word) {
+			n := fitting(word, width-col)
+			if n == 0 {
+				break
+			}
+			b.WriteString(word[:n] + "\n" + hang)
+			word = word[n:]
+			col = hangWidth
+			w = displayWidth(word)
+		}
+		b.WriteString(word)
+		col += w
+		fresh = false
+	}
+	return b.String()
+}
+
+// Returns how many bytes of the start of word fit in cols columns.
+func fitting(word string, cols int) int {
+	n := 0
+	for i, r := range word {
+		cols -= runewidth.RuneWidth(r)
+		if cols < 0 {
+			break
+		}
+		n = i + len(string(r))
+	}
+	return n
+}